@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// benchRuns holds every ns/op sample of each benchmark in a log, keyed by
+// full benchmark name; repeated -count runs add samples.
+type benchRuns struct {
+	samples map[string][]float64
+	order   []string
+}
+
+func parseRuns(scanner *bufio.Scanner) (*benchRuns, error) {
+	runs := &benchRuns{samples: make(map[string][]float64)}
+	for scanner.Scan() {
+		bl, ok := parseLine(scanner.Text())
+		if !ok || bl.metrics[0].unit != "ns/op" {
+			continue
+		}
+		if _, seen := runs.samples[bl.name]; !seen {
+			runs.order = append(runs.order, bl.name)
+		}
+		runs.samples[bl.name] = append(runs.samples[bl.name], bl.metrics[0].value)
+	}
+	return runs, scanner.Err()
+}
+
+func parseRunsFile(path string) (*benchRuns, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseRuns(bufio.NewScanner(f))
+}
+
+// comparison is the delta of one benchmark between two runs.
+type comparison struct {
+	name       string
+	old, new   []float64
+	oldMedian  float64
+	newMedian  float64
+	delta      float64 // relative change of the median; positive is slower
+	p          float64
+	confident  bool // p below alpha
+	regression bool // confident and slower by more than the threshold
+	// underpowered is set when even complete separation of the samples
+	// would not give a p below alpha, so no change can be detected.
+	underpowered bool
+}
+
+// compareRuns compares the benchmarks present in both runs, in candidate
+// order.
+func compareRuns(base, cand *benchRuns, alpha, threshold float64) []comparison {
+	var out []comparison
+	for _, name := range cand.order {
+		old, ok := base.samples[name]
+		if !ok {
+			continue
+		}
+		c := comparison{name: name, old: old, new: cand.samples[name]}
+		c.oldMedian, c.newMedian = median(c.old), median(c.new)
+		if c.oldMedian != 0 {
+			c.delta = (c.newMedian - c.oldMedian) / c.oldMedian
+		}
+		c.p = mannWhitneyP(c.old, c.new)
+		c.confident = c.p < alpha
+		c.regression = c.confident && c.delta > threshold
+		c.underpowered = minMannWhitneyP(len(c.old), len(c.new)) >= alpha
+		out = append(out, c)
+	}
+	return out
+}
+
+// writeComparison prints a benchstat-like table; deltas that are not
+// significant are shown as "~".
+func writeComparison(w io.Writer, cmps []comparison, threshold float64) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\told ns/op\tnew ns/op\tdelta\tp\tn\t")
+	for _, c := range cmps {
+		delta := "~"
+		if c.confident {
+			delta = fmt.Sprintf("%+.2f%%", 100*c.delta)
+		}
+		mark := ""
+		switch {
+		case c.regression:
+			mark = "REGRESSION"
+		case c.underpowered:
+			mark = "too few samples"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.3f\t%d+%d\t%s\n",
+			c.name, formatValue(c.oldMedian), formatValue(c.newMedian), delta, c.p, len(c.old), len(c.new), mark)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nmedians of each run; p from a two-sided Mann-Whitney U test; regression threshold %+.1f%%\n", 100*threshold)
+	return err
+}
+
+// renderComparison draws the baseline and candidate medians of one group as
+// side-by-side bars, with the candidate bar red for regressions.
+func renderComparison(group string, cmps []comparison, width, height int, outPath string) error {
+	marginX, marginY := 80, 60
+	chartWidth := width - marginX*2
+	chartHeight := height - marginY*2
+	if chartWidth <= 0 || chartHeight <= 0 {
+		return fmt.Errorf("width/height too small")
+	}
+
+	maxVal := 0.0
+	for _, c := range cmps {
+		maxVal = max(maxVal, c.oldMedian, c.newMedian)
+	}
+	if maxVal == 0 {
+		maxVal = 1
+	}
+	tickCount := 5
+	step := niceStep(maxVal / float64(tickCount))
+	maxTick := step * float64(tickCount)
+	for maxTick < maxVal {
+		maxTick += step
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img">`, width, height, width, height)
+	fmt.Fprintf(&b, `<style>text{font-family:Verdana,sans-serif;font-size:12px;fill:#1e1e1e;}</style>`)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#ffffff"/>`)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#444" stroke-width="1.2"/>`, marginX, marginY, marginX, marginY+chartHeight)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#444" stroke-width="1.2"/>`, marginX, marginY+chartHeight, marginX+chartWidth, marginY+chartHeight)
+
+	for v := 0.0; v <= maxTick+step/2; v += step {
+		y := float64(marginY) + float64(chartHeight)*(1-v/maxTick)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd" stroke-width="1"/>`, marginX, y, marginX+chartWidth, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, marginX-8, y+4, html.EscapeString(formatValue(v)))
+	}
+
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" font-size="16px" font-weight="600">%s: baseline vs candidate</text>`, width/2, marginY/2, html.EscapeString(group))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">ns/op (median)</text>`, marginX+chartWidth/2, marginY+chartHeight+35)
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="#9e9e9e"/><text x="%d" y="%d">baseline</text>`, marginX+chartWidth-170, marginY-24, marginX+chartWidth-152, marginY-14)
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="#1f77b4"/><text x="%d" y="%d">candidate</text>`, marginX+chartWidth-90, marginY-24, marginX+chartWidth-72, marginY-14)
+
+	slot := float64(chartWidth) / float64(len(cmps))
+	barW := slot * 0.35
+	for i, c := range cmps {
+		x := float64(marginX) + slot*float64(i) + slot*0.15
+		candColor := "#1f77b4"
+		if c.regression {
+			candColor = "#d62728"
+		}
+		for j, bar := range []struct {
+			v     float64
+			color string
+		}{{c.oldMedian, "#9e9e9e"}, {c.newMedian, candColor}} {
+			h := float64(chartHeight) * bar.v / maxTick
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`, x+float64(j)*barW, float64(marginY+chartHeight)-h, barW, h, bar.color)
+		}
+
+		label := "~"
+		if c.confident {
+			label = fmt.Sprintf("%+.1f%%", 100*c.delta)
+		}
+		top := float64(marginY+chartHeight) - float64(chartHeight)*max(c.oldMedian, c.newMedian)/maxTick
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="%s">%s</text>`, x+barW, top-6, candColor, html.EscapeString(label))
+		_, sub := splitBenchName(c.name)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" fill="#333">%s</text>`, x+barW, marginY+chartHeight+55, html.EscapeString(sub))
+	}
+
+	b.WriteString("</svg>")
+	return os.WriteFile(outPath, []byte(b.String()), 0o644)
+}
+
+// runCompare compares the candidate log read from scanner against the
+// baseline log, prints the table and writes one chart per group. It reports
+// whether any benchmark regressed. Having no benchmarks in common, or too few
+// samples of one to ever reach alpha, is an error rather than a pass.
+func runCompare(baselinePath string, scanner *bufio.Scanner, outDir string, width, height int, alpha, threshold float64) (bool, error) {
+	base, err := parseRunsFile(baselinePath)
+	if err != nil {
+		return false, fmt.Errorf("parsing baseline: %w", err)
+	}
+	cand, err := parseRuns(scanner)
+	if err != nil {
+		return false, fmt.Errorf("parsing candidate: %w", err)
+	}
+	cmps := compareRuns(base, cand, alpha, threshold)
+	if len(cmps) == 0 {
+		return false, errors.New("no benchmarks common to baseline and candidate")
+	}
+	if err := writeComparison(os.Stdout, cmps, threshold); err != nil {
+		return false, err
+	}
+	var underpowered []string
+	for _, c := range cmps {
+		if c.underpowered {
+			underpowered = append(underpowered, c.name)
+		}
+	}
+	if len(underpowered) > 0 {
+		return false, fmt.Errorf("too few samples to reach alpha %g for %s; rerun both with a higher -count",
+			alpha, strings.Join(underpowered, ", "))
+	}
+
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return false, fmt.Errorf("creating output directory: %w", err)
+	}
+	groups := make(map[string][]comparison)
+	var order []string
+	regressed := false
+	for _, c := range cmps {
+		group, _ := splitBenchName(c.name)
+		if _, ok := groups[group]; !ok {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], c)
+		regressed = regressed || c.regression
+	}
+	for _, group := range order {
+		outPath := filepath.Join(outDir, fmt.Sprintf("benchcmp_%s.svg", sanitizeFilename(group)))
+		if err := renderComparison(group, groups[group], width, height, outPath); err != nil {
+			log.Printf("skipping %s: %v", group, err)
+			continue
+		}
+		log.Printf("wrote %s", outPath)
+	}
+	return regressed, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func benchLog(name string, values ...string) string {
+	var b strings.Builder
+	for _, v := range values {
+		b.WriteString(name + " 1000 " + v + " ns/op\n")
+	}
+	return b.String()
+}
+
+func TestCompareRunsPower(t *testing.T) {
+	tests := []struct {
+		name         string
+		old, new     []string
+		underpowered bool
+	}{
+		{"1 vs 1", []string{"100"}, []string{"200"}, true},
+		{"3 vs 3", []string{"100", "101", "102"}, []string{"200", "201", "202"}, true},
+		{"5 vs 5", []string{"100", "101", "102", "103", "104"}, []string{"200", "201", "202", "203", "204"}, false},
+	}
+	for _, tt := range tests {
+		base, _ := parseRuns(bufio.NewScanner(strings.NewReader(benchLog("BenchmarkX", tt.old...))))
+		cand, _ := parseRuns(bufio.NewScanner(strings.NewReader(benchLog("BenchmarkX", tt.new...))))
+		cmps := compareRuns(base, cand, 0.05, 0.05)
+		if len(cmps) != 1 {
+			t.Fatalf("%s: %d comparisons, want 1", tt.name, len(cmps))
+		}
+		c := cmps[0]
+		if c.underpowered != tt.underpowered {
+			t.Errorf("%s: underpowered = %v, want %v", tt.name, c.underpowered, tt.underpowered)
+		}
+		if c.regression == tt.underpowered {
+			t.Errorf("%s: regression = %v for a doubled median", tt.name, c.regression)
+		}
+	}
+}
+
+func TestRunCompareErrors(t *testing.T) {
+	dir := t.TempDir()
+	baseline := filepath.Join(dir, "base.txt")
+	run := func(base, cand string) error {
+		t.Helper()
+		if err := os.WriteFile(baseline, []byte(base), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := runCompare(baseline, bufio.NewScanner(strings.NewReader(cand)), dir, 640, 480, 0.05, 0.05)
+		return err
+	}
+
+	if err := run(benchLog("BenchmarkA", "1", "2", "3"), benchLog("BenchmarkB", "1", "2", "3")); err == nil || !strings.Contains(err.Error(), "no benchmarks common") {
+		t.Errorf("disjoint runs: err = %v, want no common benchmarks", err)
+	}
+	if err := run(benchLog("BenchmarkA", "1", "2", "3"), benchLog("BenchmarkA", "1", "2", "3")); err == nil || !strings.Contains(err.Error(), "too few samples") {
+		t.Errorf("3 vs 3 samples: err = %v, want too few samples", err)
+	}
+	if err := run(benchLog("BenchmarkA", "1", "2", "3", "4", "5"), benchLog("BenchmarkA", "1", "2", "3", "4", "5")); err != nil {
+		t.Errorf("5 vs 5 samples: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// jsonExport is the structure written by -json.
+type jsonExport struct {
+	Environment map[string]string `json:"environment"`
+	Benchmarks  []jsonBenchmark   `json:"benchmarks"`
+}
+
+// jsonBenchmark is one result line. Repeated -count runs appear as separate
+// entries in log order.
+type jsonBenchmark struct {
+	Name       string             `json:"name"`
+	Group      string             `json:"group"`
+	Sub        string             `json:"sub,omitempty"`
+	Package    string             `json:"pkg,omitempty"`
+	Iterations int64              `json:"iterations"`
+	Metrics    map[string]float64 `json:"metrics"`
+}
+
+// exportTo writes run with write to path, or to stdout for "-".
+func exportTo(path string, run *benchRun, write func(io.Writer, *benchRun) error) error {
+	if path == "-" {
+		return write(os.Stdout, run)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f, run); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeJSON exports every result with all its metrics. The environment holds
+// the first value of each configuration key; the package of each result is
+// recorded with it, since a log of several packages changes "pkg".
+func writeJSON(w io.Writer, run *benchRun) error {
+	out := jsonExport{Environment: make(map[string]string), Benchmarks: make([]jsonBenchmark, 0, len(run.lines))}
+	for _, e := range run.env {
+		if _, ok := out.Environment[e.key]; !ok {
+			out.Environment[e.key] = e.value
+		}
+	}
+	for _, bl := range run.lines {
+		group, sub := splitBenchName(bl.name)
+		if sub == group {
+			sub = ""
+		}
+		jb := jsonBenchmark{
+			Name:       bl.name,
+			Group:      group,
+			Sub:        sub,
+			Iterations: bl.iterations,
+			Metrics:    make(map[string]float64, len(bl.metrics)),
+		}
+		for _, c := range bl.config {
+			if c.key == "pkg" {
+				jb.Package = c.value
+			}
+		}
+		for _, m := range bl.metrics {
+			jb.Metrics[m.unit] = m.value
+		}
+		out.Benchmarks = append(out.Benchmarks, jb)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// writeBenchfmt re-emits the results in the Go benchmark format, with time
+// metrics normalized to nanoseconds and each configuration line written
+// before the first result it applies to, so that benchstat reads it as it
+// would the original log.
+func writeBenchfmt(w io.Writer, run *benchRun) error {
+	written := make(map[string]string)
+	for _, bl := range run.lines {
+		for _, c := range bl.config {
+			if v, ok := written[c.key]; !ok || v != c.value {
+				if _, err := fmt.Fprintf(w, "%s: %s\n", c.key, c.value); err != nil {
+					return err
+				}
+				written[c.key] = c.value
+			}
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s\t%d", bl.name, bl.iterations)
+		for _, m := range bl.metrics {
+			fmt.Fprintf(&b, "\t%s %s", strconv.FormatFloat(m.value, 'f', -1, 64), m.unit)
+		}
+		b.WriteByte('\n')
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportLog covers two packages, so that "pkg" changes between results.
+const exportLog = `goos: linux
+goarch: amd64
+pkg: ppassrc/tests
+cpu: Test CPU @ 3.00GHz
+BenchmarkIssue-8   	    1000	       1.5 µs/op	     256 B/op	       4 allocs/op
+BenchmarkBatch/batch-16-8         	     100	         2 ms/op
+PASS
+ok  	ppassrc/tests	1.234s
+pkg: ppassrc/cmd/benchplot
+BenchmarkParse-8  	   50000	        30 ns/op
+PASS
+ok  	ppassrc/cmd/benchplot	0.456s
+`
+
+func parseExportLog(t *testing.T, log string) *benchRun {
+	t.Helper()
+	run, err := parseBench(bufio.NewScanner(strings.NewReader(log)))
+	if err != nil {
+		t.Fatalf("parseBench: %v", err)
+	}
+	return run
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, parseExportLog(t, exportLog)); err != nil {
+		t.Fatalf("writeJSON: %v", err)
+	}
+	var got jsonExport
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.Bytes())
+	}
+
+	want := jsonExport{
+		Environment: map[string]string{
+			"goos":   "linux",
+			"goarch": "amd64",
+			"pkg":    "ppassrc/tests",
+			"cpu":    "Test CPU @ 3.00GHz",
+		},
+		Benchmarks: []jsonBenchmark{
+			{
+				Name: "BenchmarkIssue-8", Group: "BenchmarkIssue-8", Package: "ppassrc/tests", Iterations: 1000,
+				Metrics: map[string]float64{"ns/op": 1500, "B/op": 256, "allocs/op": 4},
+			},
+			{
+				Name: "BenchmarkBatch/batch-16-8", Group: "BenchmarkBatch", Sub: "batch-16-8", Package: "ppassrc/tests", Iterations: 100,
+				Metrics: map[string]float64{"ns/op": 2e6},
+			},
+			{
+				Name: "BenchmarkParse-8", Group: "BenchmarkParse-8", Package: "ppassrc/cmd/benchplot", Iterations: 50000,
+				Metrics: map[string]float64{"ns/op": 30},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("writeJSON wrote\n%s\nwant %+v", buf.Bytes(), want)
+	}
+}
+
+func TestWriteBenchfmt(t *testing.T) {
+	run := parseExportLog(t, exportLog)
+	var buf bytes.Buffer
+	if err := writeBenchfmt(&buf, run); err != nil {
+		t.Fatalf("writeBenchfmt: %v", err)
+	}
+
+	want := "goos: linux\n" +
+		"goarch: amd64\n" +
+		"pkg: ppassrc/tests\n" +
+		"cpu: Test CPU @ 3.00GHz\n" +
+		"BenchmarkIssue-8\t1000\t1500 ns/op\t256 B/op\t4 allocs/op\n" +
+		"BenchmarkBatch/batch-16-8\t100\t2000000 ns/op\n" +
+		"pkg: ppassrc/cmd/benchplot\n" +
+		"BenchmarkParse-8\t50000\t30 ns/op\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("writeBenchfmt wrote\n%s\nwant\n%s", got, want)
+	}
+
+	// The output parses back to the same results and configuration.
+	again := parseExportLog(t, buf.String())
+	if !reflect.DeepEqual(again.lines, run.lines) || !reflect.DeepEqual(again.env, run.env) {
+		t.Errorf("re-parsed output differs:\n%+v\nwant\n%+v", again.lines, run.lines)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sweepPoint aggregates the repeated samples of one parameter value.
+type sweepPoint struct {
+	x        float64
+	mean     float64
+	min, max float64
+	n        int
+}
+
+// numericParam splits a sub-benchmark label such as "batch-16" into its
+// parameter name and value. A second numeric suffix, as in "batch-16-8", is
+// the GOMAXPROCS suffix the testing package appends and is dropped.
+func numericParam(label string) (string, float64, bool) {
+	prefix, x, ok := cutNumber(label)
+	if !ok {
+		return "", 0, false
+	}
+	if p, inner, ok := cutNumber(prefix); ok {
+		prefix, x = p, inner
+	}
+	return prefix, x, prefix != ""
+}
+
+func cutNumber(label string) (string, float64, bool) {
+	idx := strings.LastIndex(label, "-")
+	if idx == -1 {
+		return "", 0, false
+	}
+	x, err := strconv.ParseFloat(label[idx+1:], 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return label[:idx], x, true
+}
+
+// sweepOf reports whether every sample of series is the same parameter at
+// two or more numeric values, and aggregates the samples per value.
+func sweepOf(series benchSeries) (string, []sweepPoint, bool) {
+	var param string
+	byX := make(map[float64]*sweepPoint)
+	for i, sample := range series.samples {
+		prefix, x, ok := numericParam(sample.label)
+		if !ok || (i > 0 && prefix != param) {
+			return "", nil, false
+		}
+		param = prefix
+		p, seen := byX[x]
+		if !seen {
+			p = &sweepPoint{x: x, min: sample.value, max: sample.value}
+			byX[x] = p
+		}
+		p.mean += sample.value
+		p.min = math.Min(p.min, sample.value)
+		p.max = math.Max(p.max, sample.value)
+		p.n++
+	}
+	if len(byX) < 2 {
+		return "", nil, false
+	}
+
+	points := make([]sweepPoint, 0, len(byX))
+	for _, p := range byX {
+		p.mean /= float64(p.n)
+		points = append(points, *p)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].x < points[j].x })
+	return param, points, true
+}
+
+// idealScaling returns the time per operation each point would have if the
+// first one scaled linearly with GOMAXPROCS, or nil if series is not a
+// time metric of a GOMAXPROCS sweep.
+func idealScaling(param, unit string, points []sweepPoint) []float64 {
+	if param != "procs" || !strings.HasPrefix(unit, "ns/") || points[0].x <= 0 {
+		return nil
+	}
+	ideal := make([]float64, len(points))
+	for i, p := range points {
+		ideal[i] = points[0].mean * points[0].x / p.x
+	}
+	return ideal
+}
+
+// sweepSVG draws a parameter sweep as a line chart over a numeric x-axis,
+// with min/max error bars where a value was measured more than once.
+func sweepSVG(name, param string, series benchSeries, points []sweepPoint, logX bool, width, height int) (string, error) {
+	marginX, marginY := 80, 60
+	chartWidth := width - marginX*2
+	chartHeight := height - marginY*2
+	if chartWidth <= 0 || chartHeight <= 0 {
+		return "", fmt.Errorf("width/height too small")
+	}
+
+	ideal := idealScaling(param, series.axisUnit, points)
+	maxVal := 0.0
+	for i, p := range points {
+		maxVal = math.Max(maxVal, p.max)
+		if ideal != nil {
+			maxVal = math.Max(maxVal, ideal[i])
+		}
+	}
+	if maxVal == 0 {
+		maxVal = 1
+	}
+	tickCount := 5
+	step := niceStep(maxVal / float64(tickCount))
+	maxTick := math.Ceil(maxVal/step) * step
+
+	if points[0].x <= 0 {
+		logX = false
+	}
+	scaleX := func(x float64) float64 { return x }
+	if logX {
+		scaleX = math.Log
+	}
+	lo, hi := scaleX(points[0].x), scaleX(points[len(points)-1].x)
+	px := func(x float64) float64 {
+		return float64(marginX) + 20 + (float64(chartWidth)-40)*(scaleX(x)-lo)/(hi-lo)
+	}
+	py := func(v float64) float64 {
+		return float64(marginY) + float64(chartHeight)*(1-v/maxTick)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img">`, width, height, width, height)
+	fmt.Fprintf(&b, `<style>text{font-family:Verdana,sans-serif;font-size:12px;fill:#1e1e1e;}</style>`)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#ffffff"/>`)
+
+	// Axes
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#444" stroke-width="1.2"/>`, marginX, marginY, marginX, marginY+chartHeight)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#444" stroke-width="1.2"/>`, marginX, marginY+chartHeight, marginX+chartWidth, marginY+chartHeight)
+
+	// Y ticks
+	for v := 0.0; v <= maxTick+step/2; v += step {
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd" stroke-width="1"/>`, marginX, py(v), marginX+chartWidth, py(v))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, marginX-8, py(v)+4, html.EscapeString(formatValue(v)))
+	}
+	// X ticks at the measured parameter values
+	for _, p := range points {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#444" stroke-width="1"/>`, px(p.x), marginY+chartHeight, px(p.x), marginY+chartHeight+5)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" fill="#333">%s</text>`, px(p.x), marginY+chartHeight+20, html.EscapeString(formatValue(p.x)))
+	}
+
+	// Axis labels & title
+	xLabel := param
+	if logX {
+		xLabel += " (log scale)"
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" font-size="16px" font-weight="600">%s</text>`, width/2, marginY/2, html.EscapeString(name))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">%s</text>`, marginX+chartWidth/2, marginY+chartHeight+45, html.EscapeString(xLabel))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" transform="rotate(-90 %d %d)">%s</text>`, marginX/3, marginY+chartHeight/2, marginX/3, marginY+chartHeight/2, html.EscapeString(series.axisUnit))
+
+	if ideal != nil {
+		line := make([]string, len(points))
+		for i, p := range points {
+			line[i] = fmt.Sprintf("%.1f,%.1f", px(p.x), py(ideal[i]))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#2ca02c" stroke-width="2" stroke-dasharray="6 4"/>`, strings.Join(line, " "))
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#2ca02c" stroke-width="2" stroke-dasharray="6 4"/><text x="%d" y="%d">ideal scaling</text>`,
+			marginX+chartWidth-150, marginY-16, marginX+chartWidth-126, marginY-16, marginX+chartWidth-120, marginY-12)
+	}
+
+	line := make([]string, len(points))
+	for i, p := range points {
+		line[i] = fmt.Sprintf("%.1f,%.1f", px(p.x), py(p.mean))
+	}
+	fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#ff7f0e" stroke-width="3" stroke-linejoin="round" stroke-linecap="round"/>`, strings.Join(line, " "))
+	for _, p := range points {
+		x := px(p.x)
+		if p.n > 1 {
+			fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#1f77b4" stroke-width="1.5"/>`, x, py(p.min), x, py(p.max))
+			for _, v := range []float64{p.min, p.max} {
+				fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#1f77b4" stroke-width="1.5"/>`, x-5, py(v), x+5, py(v))
+			}
+		}
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="5" fill="#1f77b4"><title>%s=%s: mean %s over %d run(s)</title></circle>`,
+			x, py(p.mean), html.EscapeString(param), formatValue(p.x), formatValue(p.mean), p.n)
+	}
+
+	b.WriteString("</svg>")
+	return b.String(), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNumericParam(t *testing.T) {
+	tests := []struct {
+		label string
+		param string
+		x     float64
+		ok    bool
+	}{
+		{"batch-16", "batch", 16, true},
+		{"batch-16-8", "batch", 16, true},
+		{"window-0.5", "window", 0.5, true},
+		{"size-1e3-4", "size", 1000, true},
+		{"keys-per-shard-64", "keys-per-shard", 64, true},
+		{"batch", "", 0, false},
+		{"batch-x", "", 0, false},
+		{"16", "", 0, false},
+		{"-16", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tt := range tests {
+		param, x, ok := numericParam(tt.label)
+		if ok != tt.ok || ok && (param != tt.param || x != tt.x) {
+			t.Errorf("numericParam(%q) = %q, %g, %v; want %q, %g, %v", tt.label, param, x, ok, tt.param, tt.x, tt.ok)
+		}
+	}
+}
+
+func TestSweepOf(t *testing.T) {
+	series := func(labels ...string) benchSeries {
+		s := benchSeries{axisUnit: "ns/op"}
+		for i, l := range labels {
+			s.samples = append(s.samples, benchSample{label: l, value: float64(10 * (i + 1))})
+		}
+		return s
+	}
+
+	param, points, ok := sweepOf(series("batch-4-8", "batch-1-8", "batch-1-8"))
+	want := []sweepPoint{{x: 1, mean: 25, min: 20, max: 30, n: 2}, {x: 4, mean: 10, min: 10, max: 10, n: 1}}
+	if !ok || param != "batch" || !reflect.DeepEqual(points, want) {
+		t.Errorf("sweepOf = %q, %+v, %v; want %q, %+v, true", param, points, ok, "batch", want)
+	}
+
+	for name, s := range map[string]benchSeries{
+		"mixed parameters": series("batch-1", "batch-2", "size-4"),
+		"single value":     series("batch-16-8", "batch-16-8"),
+		"not numeric":      series("small", "large"),
+		"partly numeric":   series("batch-1", "batch-2", "batch-max"),
+		"empty":            series(),
+	} {
+		if param, points, ok := sweepOf(s); ok {
+			t.Errorf("%s: sweepOf = %q, %+v, true; want false", name, param, points)
+		}
+	}
+}
+
+func TestIdealScaling(t *testing.T) {
+	points := []sweepPoint{{x: 1, mean: 100}, {x: 2, mean: 60}, {x: 4, mean: 40}}
+	if got, want := idealScaling("procs", "ns/op", points), []float64{100, 50, 25}; !reflect.DeepEqual(got, want) {
+		t.Errorf("idealScaling over procs = %v, want %v", got, want)
+	}
+	for _, tt := range []struct{ param, unit string }{
+		{"procs", "B/op"},
+		{"procs", "allocs/op"},
+		{"procs", "tokens/s"},
+		{"batch", "ns/op"},
+	} {
+		if got := idealScaling(tt.param, tt.unit, points); got != nil {
+			t.Errorf("idealScaling(%q, %q) = %v, want nil", tt.param, tt.unit, got)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -19,23 +20,89 @@ type benchSample struct {
 	value float64
 }
 
-type benchGroup struct {
+// benchSeries holds the values of one metric across a benchmark group.
+type benchSeries struct {
 	samples  []benchSample
 	axisUnit string
 }
 
+// benchGroup holds one series per metric reported by the group's
+// benchmarks, in the order the metrics first appear.
+type benchGroup struct {
+	series []*benchSeries
+}
+
+func (g *benchGroup) metric(unit string) *benchSeries {
+	for _, s := range g.series {
+		if s.axisUnit == unit {
+			return s
+		}
+	}
+	s := &benchSeries{axisUnit: unit}
+	g.series = append(g.series, s)
+	return s
+}
+
+// benchRun is a parsed benchmark log: its groups in order of appearance and
+// the configuration lines (goos, goarch, pkg, cpu, ...) printed before them.
+type benchRun struct {
+	groups map[string]*benchGroup
+	order  []string
+	env    []envEntry
+	lines  []benchLine
+}
+
+// envEntry is one "key: value" configuration line of a benchmark log.
+type envEntry struct {
+	key, value string
+}
+
+// benchLine is one result line of a benchmark log.
+type benchLine struct {
+	name       string
+	iterations int64
+	metrics    []benchMetric
+	config     []envEntry // configuration in effect, latest value per key
+}
+
+// benchMetric is one value/unit pair of a result line, normalized by
+// normalizeValue.
+type benchMetric struct {
+	value float64
+	unit  string
+}
+
 func main() {
 	inputPath := flag.String("in", "", "path to benchmark log (stdin when empty)")
 	outDir := flag.String("out-dir", ".", "output directory for generated plots")
 	dataDir := flag.String("data-dir", "", "directory to write textual benchmark summaries (disabled when empty)")
 	width := flag.Int("width", 1200, "SVG width in pixels")
 	height := flag.Int("height", 640, "SVG width in pixels")
+	logX := flag.Bool("logx", false, "use a logarithmic x-axis for parameter sweeps")
+	baselinePath := flag.String("baseline", "", "baseline benchmark log; compares -in against it instead of plotting")
+	threshold := flag.Float64("threshold", 5, "regression threshold in percent of the baseline median (with -baseline)")
+	alpha := flag.Float64("alpha", 0.05, "significance level for reporting a change (with -baseline)")
+	jsonPath := flag.String("json", "", "also export all results as JSON to this file (- for stdout)")
+	benchfmtPath := flag.String("benchfmt", "", "also re-emit the results in normalized Go benchmark format for benchstat to this file (- for stdout)")
+	htmlPath := flag.String("html", "", "write a self-contained HTML report of the logs given as arguments (or -in) instead of SVG files")
 	flag.Parse()
 
 	if *width <= 0 || *height <= 0 {
 		log.Fatal("width and height must be positive values")
 	}
 
+	if *htmlPath != "" {
+		paths := flag.Args()
+		if len(paths) == 0 {
+			paths = []string{*inputPath}
+		}
+		if err := runReport(*htmlPath, paths, *logX, *width, *height); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("wrote %s", *htmlPath)
+		return
+	}
+
 	var scanner *bufio.Scanner
 	if *inputPath == "" {
 		scanner = bufio.NewScanner(os.Stdin)
@@ -48,16 +115,41 @@ func main() {
 		scanner = bufio.NewScanner(f)
 	}
 
-	groups, order, err := parseBench(scanner)
+	if *baselinePath != "" {
+		if *threshold < 0 || *alpha <= 0 || *alpha >= 1 {
+			log.Fatal("threshold must be non-negative and alpha within (0, 1)")
+		}
+		regressed, err := runCompare(*baselinePath, scanner, *outDir, *width, *height, *alpha, *threshold/100)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if regressed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	run, err := parseBench(scanner)
 	if err != nil {
 		log.Fatalf("parsing benchmarks: %v", err)
 	}
 
-	if len(order) == 0 {
+	if len(run.order) == 0 {
 		log.Println("no benchmark data detected")
 		return
 	}
 
+	if *jsonPath != "" {
+		if err := exportTo(*jsonPath, run, writeJSON); err != nil {
+			log.Fatalf("writing JSON: %v", err)
+		}
+	}
+	if *benchfmtPath != "" {
+		if err := exportTo(*benchfmtPath, run, writeBenchfmt); err != nil {
+			log.Fatalf("writing benchmark format: %v", err)
+		}
+	}
+
 	if err := os.MkdirAll(*outDir, 0o755); err != nil {
 		log.Fatalf("creating output directory: %v", err)
 	}
@@ -67,27 +159,40 @@ func main() {
 		}
 	}
 
-	for _, name := range order {
-		group := groups[name]
-		if len(group.samples) == 0 {
-			continue
-		}
-		outPath := filepath.Join(*outDir, fmt.Sprintf("benchplot_%s.svg", sanitizeFilename(name)))
-		if err := renderGroup(name, group, *width, *height, outPath); err != nil {
-			log.Printf("skipping %s: %v", name, err)
-			continue
+	for _, name := range run.order {
+		group := run.groups[name]
+		wrote := false
+		for _, series := range group.series {
+			outPath := filepath.Join(*outDir, fmt.Sprintf("benchplot_%s.svg", chartFilename(name, series.axisUnit)))
+			svg, err := seriesSVG(name, *series, *logX, *width, *height)
+			if err == nil {
+				err = os.WriteFile(outPath, []byte(svg), 0o644)
+			}
+			if err != nil {
+				log.Printf("skipping %s %s: %v", name, series.axisUnit, err)
+				continue
+			}
+			log.Printf("wrote %s", outPath)
+			wrote = true
 		}
-		if *dataDir != "" {
+		if wrote && *dataDir != "" {
 			if err := writeGroupData(name, group, *dataDir); err != nil {
 				log.Printf("writing data %s: %v", name, err)
-				continue
 			}
 		}
-		log.Printf("wrote %s", outPath)
 	}
 }
 
-func writeGroupData(name string, group benchGroup, dir string) error {
+// chartFilename names the chart of one metric of a group; ns/op charts keep
+// the plain group name.
+func chartFilename(group, unit string) string {
+	if unit == "ns/op" {
+		return sanitizeFilename(group)
+	}
+	return sanitizeFilename(group) + "_" + sanitizeFilename(unit)
+}
+
+func writeGroupData(name string, group *benchGroup, dir string) error {
 	path := filepath.Join(dir, fmt.Sprintf("benchdata_%s.txt", sanitizeFilename(name)))
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
 	if err != nil {
@@ -96,61 +201,107 @@ func writeGroupData(name string, group benchGroup, dir string) error {
 	defer f.Close()
 
 	fmt.Fprintf(f, "# %s\n", name)
-	fmt.Fprintf(f, "# axis unit: %s\n", group.axisUnit)
-	fmt.Fprintf(f, "label,value\n")
-	for _, sample := range group.samples {
-		fmt.Fprintf(f, "%s,%g\n", sample.label, sample.value)
+	units := make([]string, len(group.series))
+	for i, series := range group.series {
+		units[i] = series.axisUnit
+	}
+	fmt.Fprintf(f, "# metrics: %s\n", strings.Join(units, ", "))
+	fmt.Fprintf(f, "label,unit,value\n")
+	for _, series := range group.series {
+		for _, sample := range series.samples {
+			fmt.Fprintf(f, "%s,%s,%g\n", sample.label, series.axisUnit, sample.value)
+		}
 	}
 	return nil
 }
 
-func parseBench(scanner *bufio.Scanner) (map[string]benchGroup, []string, error) {
-	groups := make(map[string]benchGroup)
-	order := make([]string, 0, 8)
+// parseLine parses a benchmark result line: the name, the iteration count
+// and any number of value/unit pairs, such as the -benchmem columns and
+// b.ReportMetric values.
+func parseLine(line string) (benchLine, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+		return benchLine{}, false
+	}
+	iterations, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return benchLine{}, false
+	}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || !strings.HasPrefix(line, "Benchmark") {
-			continue
+	bl := benchLine{name: fields[0], iterations: iterations}
+	for i := 2; i+1 < len(fields); i += 2 {
+		parsed, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			break
 		}
+		value, unit := normalizeValue(parsed, fields[i+1])
+		bl.metrics = append(bl.metrics, benchMetric{value: value, unit: unit})
+	}
+	return bl, len(bl.metrics) > 0
+}
 
-		fields := strings.Fields(line)
-		if len(fields) < 4 {
-			continue
-		}
+// parseConfigLine parses a "key: value" configuration line as printed by
+// go test before the results, such as "goos: linux" or "cpu: ...".
+func parseConfigLine(line string) (envEntry, bool) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok || key == "" || !unicode.IsLower(rune(key[0])) || strings.ContainsFunc(key, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsUpper(r)
+	}) {
+		return envEntry{}, false
+	}
+	return envEntry{key: key, value: strings.TrimSpace(value)}, true
+}
 
-		name := fields[0]
-		rawValue := fields[2]
-		unit := fields[3]
+func parseBench(scanner *bufio.Scanner) (*benchRun, error) {
+	run := &benchRun{groups: make(map[string]*benchGroup), order: make([]string, 0, 8)}
+	var config []envEntry
 
-		parsed, err := strconv.ParseFloat(rawValue, 64)
-		if err != nil {
+	for scanner.Scan() {
+		bl, ok := parseLine(scanner.Text())
+		if !ok {
+			if e, ok := parseConfigLine(scanner.Text()); ok {
+				if !slices.Contains(run.env, e) {
+					run.env = append(run.env, e)
+				}
+				config = slices.DeleteFunc(slices.Clone(config), func(c envEntry) bool { return c.key == e.key })
+				config = append(config, e)
+			}
 			continue
 		}
+		bl.config = config
+		run.lines = append(run.lines, bl)
 
-		value, axisUnit := normalizeValue(parsed, unit)
-		groupName, label := splitBenchName(name)
-
-		group, exists := groups[groupName]
+		groupName, label := splitBenchName(bl.name)
+		group, exists := run.groups[groupName]
 		if !exists {
-			order = append(order, groupName)
+			group = &benchGroup{}
+			run.groups[groupName] = group
+			run.order = append(run.order, groupName)
 		}
-		if group.axisUnit == "" {
-			group.axisUnit = axisUnit
+		for _, m := range bl.metrics {
+			series := group.metric(m.unit)
+			series.samples = append(series.samples, benchSample{label: label, value: m.value})
 		}
-		group.samples = append(group.samples, benchSample{label: label, value: value})
-		groups[groupName] = group
 	}
 
-	return groups, order, scanner.Err()
+	return run, scanner.Err()
+}
+
+// seriesSVG draws one metric of a group: a line chart for a numeric
+// parameter sweep, otherwise one point per sub-benchmark.
+func seriesSVG(name string, series benchSeries, logX bool, width, height int) (string, error) {
+	if param, points, ok := sweepOf(series); ok {
+		return sweepSVG(name, param, series, points, logX, width, height)
+	}
+	return groupSVG(name, series, width, height)
 }
 
-func renderGroup(name string, group benchGroup, width, height int, outPath string) error {
+func groupSVG(name string, group benchSeries, width, height int) (string, error) {
 	marginX, marginY := 80, 60
 	chartWidth := width - marginX*2
 	chartHeight := height - marginY*2
 	if chartWidth <= 0 || chartHeight <= 0 {
-		return fmt.Errorf("width/height too small")
+		return "", fmt.Errorf("width/height too small")
 	}
 
 	maxVal := 0.0
@@ -213,7 +364,7 @@ func renderGroup(name string, group benchGroup, width, height int, outPath strin
 
 	b.WriteString("</svg>")
 
-	return os.WriteFile(outPath, []byte(b.String()), 0o644)
+	return b.String(), nil
 }
 
 func niceStep(raw float64) float64 {
@@ -251,11 +402,13 @@ func formatValue(v float64) string {
 	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
 }
 
+// normalizeValue converts time metrics such as "ms/op" or "us/token" to
+// nanoseconds per the same denominator; other units are kept as they are.
 func normalizeValue(value float64, unit string) (float64, string) {
 	if idx := strings.Index(unit, "/"); idx != -1 {
 		head := unit[:idx]
 		if scale, ok := timeScale(head); ok {
-			return value * scale, "ns/op"
+			return value * scale, "ns" + unit[idx:]
 		}
 	}
 	return value, unit
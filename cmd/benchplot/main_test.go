@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want benchLine
+	}{
+		{"BenchmarkIssue-8   \t 1000\t  1234 ns/op", benchLine{
+			name: "BenchmarkIssue-8", iterations: 1000,
+			metrics: []benchMetric{{1234, "ns/op"}},
+		}},
+		{"BenchmarkIssue/batch-16-8  500  2.5 ms/op  1024 B/op  12 allocs/op", benchLine{
+			name: "BenchmarkIssue/batch-16-8", iterations: 500,
+			metrics: []benchMetric{{2.5e6, "ns/op"}, {1024, "B/op"}, {12, "allocs/op"}},
+		}},
+		{"BenchmarkRedeem 10 1.5 µs/op 3.5 tokens/s 2 s/token", benchLine{
+			name: "BenchmarkRedeem", iterations: 10,
+			metrics: []benchMetric{{1500, "ns/op"}, {3.5, "tokens/s"}, {2e9, "ns/token"}},
+		}},
+		{"BenchmarkRedeem 10 100 ns/op junk", benchLine{
+			name: "BenchmarkRedeem", iterations: 10,
+			metrics: []benchMetric{{100, "ns/op"}},
+		}},
+		{"BenchmarkRedeem 10 100 ns/op fast B/op 7 allocs/op", benchLine{
+			name: "BenchmarkRedeem", iterations: 10,
+			metrics: []benchMetric{{100, "ns/op"}},
+		}},
+	}
+	for _, tt := range tests {
+		got, ok := parseLine(tt.line)
+		if !ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLine(%q) = %+v, %v; want %+v, true", tt.line, got, ok, tt.want)
+		}
+	}
+
+	for _, line := range []string{
+		"",
+		"PASS",
+		"goos: linux",
+		"ok  \tppassrc/tests\t1.234s",
+		"BenchmarkIssue-8 1000",
+		"BenchmarkIssue-8 many 1234 ns/op",
+		"BenchmarkIssue-8 1000 fast ns/op",
+		"TestIssue 1000 1234 ns/op",
+	} {
+		if got, ok := parseLine(line); ok {
+			t.Errorf("parseLine(%q) = %+v, want no result", line, got)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// reportRun is one benchmark log in an HTML report.
+type reportRun struct {
+	title    string
+	modified time.Time
+	run      *benchRun
+}
+
+func parseBenchFile(path string) (*benchRun, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseBench(bufio.NewScanner(f))
+}
+
+// runReport writes a self-contained HTML report of the logs at paths, oldest
+// first; an empty path is stdin.
+func runReport(outPath string, paths []string, logX bool, width, height int) error {
+	runs := make([]reportRun, 0, len(paths))
+	for _, path := range paths {
+		rr := reportRun{title: filepath.Base(path)}
+		var err error
+		if path == "" {
+			rr.title, rr.modified = "stdin", time.Now()
+			rr.run, err = parseBench(bufio.NewScanner(os.Stdin))
+		} else {
+			if fi, statErr := os.Stat(path); statErr == nil {
+				rr.modified = fi.ModTime()
+			}
+			rr.run, err = parseBenchFile(path)
+		}
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", rr.title, err)
+		}
+		runs = append(runs, rr)
+	}
+
+	var b strings.Builder
+	if err := writeReport(&b, runs, logX, width, height); err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, []byte(b.String()), 0o644)
+}
+
+// writeReport renders the runs, newest first, each with its environment,
+// charts and summary tables, preceded by a table of contents and, for more
+// than one run, the ns/op trend of every benchmark across the runs.
+func writeReport(b *strings.Builder, runs []reportRun, logX bool, width, height int) error {
+	b.WriteString(`<!DOCTYPE html>
+<html lang="en"><head><meta charset="utf-8"><title>Benchmark report</title>
+<style>
+body{font-family:Verdana,sans-serif;font-size:14px;color:#1e1e1e;max-width:1280px;margin:2em auto;padding:0 1em}
+table{border-collapse:collapse;margin:1em 0}
+th,td{border:1px solid #ccc;padding:4px 10px;text-align:right}
+th:first-child,td:first-child{text-align:left}
+th{background:#f3f3f3}
+dl.env{display:grid;grid-template-columns:max-content auto;gap:2px 1em}
+dl.env dt{font-weight:600}
+svg{max-width:100%;height:auto;display:block;margin:1em 0}
+</style></head><body>
+<h1>Benchmark report</h1>
+`)
+	fmt.Fprintf(b, "<p>Generated %s from %d run(s).</p>\n", time.Now().Format(time.RFC3339), len(runs))
+
+	b.WriteString("<h2>Runs</h2>\n<ul>\n")
+	for i := len(runs) - 1; i >= 0; i-- {
+		fmt.Fprintf(b, `<li><a href="#run-%d">%s</a> (%s, %d groups)</li>`+"\n",
+			i, html.EscapeString(runs[i].title), runs[i].modified.Format("2006-01-02 15:04"), len(runs[i].run.order))
+	}
+	b.WriteString("</ul>\n")
+
+	if len(runs) > 1 {
+		writeTrend(b, runs)
+	}
+
+	for i := len(runs) - 1; i >= 0; i-- {
+		rr := runs[i]
+		fmt.Fprintf(b, `<h2 id="run-%d">%s</h2>`+"\n", i, html.EscapeString(rr.title))
+		if len(rr.run.env) > 0 {
+			b.WriteString(`<dl class="env">`)
+			for _, e := range rr.run.env {
+				fmt.Fprintf(b, "<dt>%s</dt><dd>%s</dd>", html.EscapeString(e.key), html.EscapeString(e.value))
+			}
+			b.WriteString("</dl>\n")
+		}
+		if len(rr.run.order) == 0 {
+			b.WriteString("<p>No benchmark data.</p>\n")
+			continue
+		}
+		for _, name := range rr.run.order {
+			group := rr.run.groups[name]
+			fmt.Fprintf(b, "<h3>%s</h3>\n", html.EscapeString(name))
+			writeSummary(b, group)
+			for _, series := range group.series {
+				svg, err := seriesSVG(name, *series, logX, width, height)
+				if err != nil {
+					return err
+				}
+				b.WriteString(svg)
+				b.WriteByte('\n')
+			}
+		}
+	}
+	b.WriteString("</body></html>\n")
+	return nil
+}
+
+// writeSummary tabulates the mean of every metric per sub-benchmark.
+func writeSummary(b *strings.Builder, group *benchGroup) {
+	type cell struct {
+		sum float64
+		n   int
+	}
+	var labels []string
+	cells := make(map[string][]cell)
+	for j, series := range group.series {
+		for _, sample := range series.samples {
+			row, ok := cells[sample.label]
+			if !ok {
+				labels = append(labels, sample.label)
+				row = make([]cell, len(group.series))
+				cells[sample.label] = row
+			}
+			row[j].sum += sample.value
+			row[j].n++
+		}
+	}
+
+	b.WriteString("<table><tr><th>benchmark</th>")
+	for _, series := range group.series {
+		fmt.Fprintf(b, "<th>%s</th>", html.EscapeString(series.axisUnit))
+	}
+	b.WriteString("<th>runs</th></tr>\n")
+	for _, label := range labels {
+		fmt.Fprintf(b, "<tr><td>%s</td>", html.EscapeString(label))
+		runs := 0
+		for _, c := range cells[label] {
+			if c.n == 0 {
+				b.WriteString("<td></td>")
+				continue
+			}
+			fmt.Fprintf(b, "<td>%s</td>", formatValue(c.sum/float64(c.n)))
+			runs = max(runs, c.n)
+		}
+		fmt.Fprintf(b, "<td>%d</td></tr>\n", runs)
+	}
+	b.WriteString("</table>\n")
+}
+
+// writeTrend tabulates the mean ns/op of every benchmark in each run, oldest
+// run first, with the change from the first to the last run measured.
+func writeTrend(b *strings.Builder, runs []reportRun) {
+	var names []string
+	means := make(map[string][]float64)
+	for i, rr := range runs {
+		for _, groupName := range rr.run.order {
+			for _, series := range rr.run.groups[groupName].series {
+				if series.axisUnit != "ns/op" {
+					continue
+				}
+				sums := make(map[string][2]float64)
+				var labels []string
+				for _, sample := range series.samples {
+					if _, ok := sums[sample.label]; !ok {
+						labels = append(labels, sample.label)
+					}
+					s := sums[sample.label]
+					sums[sample.label] = [2]float64{s[0] + sample.value, s[1] + 1}
+				}
+				for _, label := range labels {
+					name := groupName
+					if label != groupName {
+						name += "/" + label
+					}
+					row, ok := means[name]
+					if !ok {
+						names = append(names, name)
+						row = make([]float64, len(runs))
+						means[name] = row
+					}
+					row[i] = sums[label][0] / sums[label][1]
+				}
+			}
+		}
+	}
+
+	b.WriteString("<h2>Trend (ns/op)</h2>\n<table><tr><th>benchmark</th>")
+	for i, rr := range runs {
+		fmt.Fprintf(b, `<th><a href="#run-%d">%s</a></th>`, i, html.EscapeString(rr.title))
+	}
+	b.WriteString("<th>change</th></tr>\n")
+	for _, name := range names {
+		fmt.Fprintf(b, "<tr><td>%s</td>", html.EscapeString(name))
+		first, last := 0.0, 0.0
+		for _, v := range means[name] {
+			if v == 0 {
+				b.WriteString("<td></td>")
+				continue
+			}
+			if first == 0 {
+				first = v
+			}
+			last = v
+			fmt.Fprintf(b, "<td>%s</td>", formatValue(v))
+		}
+		change := ""
+		if first != 0 && last != first {
+			change = fmt.Sprintf("%+.1f%%", 100*(last-first)/first)
+		}
+		fmt.Fprintf(b, "<td>%s</td></tr>\n", change)
+	}
+	b.WriteString("</table>\n")
+}
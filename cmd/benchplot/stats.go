@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+func median(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// mannWhitneyP returns the two-sided p-value of the Mann-Whitney U test for
+// samples a and b. Small samples without ties use the exact distribution of
+// U; otherwise the tie-corrected normal approximation is used.
+func mannWhitneyP(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type obs struct {
+		v     float64
+		first bool
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, v := range a {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range b {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// Average ranks over ties; tieTerm accumulates t³−t per tie group.
+	r1, tieTerm := 0.0, 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // mean of ranks i+1 .. j
+		for k := i; k < j; k++ {
+			if all[k].first {
+				r1 += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			tieTerm += t*t*t - t
+		}
+		i = j
+	}
+	u := r1 - float64(n1*(n1+1))/2
+
+	if tieTerm == 0 && n1*n2 <= 400 {
+		return exactMannWhitneyP(n1, n2, int(math.Round(u)))
+	}
+
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - tieTerm/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	d := math.Abs(u-mu) - 0.5 // continuity correction
+	if d < 0 {
+		d = 0
+	}
+	return math.Erfc(d / sigma / math.Sqrt2)
+}
+
+// minMannWhitneyP is the smallest p mannWhitneyP can return for samples of
+// sizes n1 and n2, reached when they do not overlap. For samples too large
+// for the exact test it is far below any useful alpha and reported as 0.
+func minMannWhitneyP(n1, n2 int) float64 {
+	switch {
+	case n1 == 0 || n2 == 0:
+		return 1
+	case n1*n2 > 400:
+		return 0
+	}
+	return exactMannWhitneyP(n1, n2, 0)
+}
+
+// exactMannWhitneyP computes the two-sided p-value of U = u by counting the
+// arrangements of n1 and n2 observations with each value of U.
+func exactMannWhitneyP(n1, n2, u int) float64 {
+	maxU := n1 * n2
+	// counts[i][j] is the distribution of U for i and j observations.
+	counts := make([][][]float64, n1+1)
+	for i := range counts {
+		counts[i] = make([][]float64, n2+1)
+		for j := range counts[i] {
+			counts[i][j] = make([]float64, i*j+1)
+			switch {
+			case i == 0 || j == 0:
+				counts[i][j][0] = 1
+			default:
+				for k := range counts[i][j] {
+					// The largest observation is either from the first
+					// sample (adding j to U) or from the second.
+					if k-j >= 0 && k-j < len(counts[i-1][j]) {
+						counts[i][j][k] += counts[i-1][j][k-j]
+					}
+					if k < len(counts[i][j-1]) {
+						counts[i][j][k] += counts[i][j-1][k]
+					}
+				}
+			}
+		}
+	}
+
+	dist := counts[n1][n2]
+	total, lower, upper := 0.0, 0.0, 0.0
+	for k := 0; k <= maxU; k++ {
+		total += dist[k]
+		if k <= u {
+			lower += dist[k]
+		}
+		if k >= u {
+			upper += dist[k]
+		}
+	}
+	return math.Min(1, 2*math.Min(lower, upper)/total)
+}
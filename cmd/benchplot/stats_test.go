@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// Reference p-values are two-sided, with the continuity correction for the
+// normal approximation, as R's wilcox.test reports them.
+func TestMannWhitneyP(t *testing.T) {
+	evens := make([]float64, 21)
+	for i := range evens {
+		evens[i] = float64(2 * i)
+	}
+	odds := make([]float64, 20)
+	for i := range odds {
+		odds[i] = float64(2*i + 15)
+	}
+
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"exact, separated", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 0.0079365},
+		{"exact, separated, swapped", []float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 0.0079365},
+		{"exact, overlapping", // the example in R's ?wilcox.test
+			[]float64{0.80, 0.83, 1.89, 1.04, 1.45, 1.38, 1.91, 1.64, 0.73, 1.46},
+			[]float64{1.15, 0.88, 0.90, 0.74, 1.21}, 0.25441},
+		{"normal, 21x20 without ties", evens, odds, 0.0019967},
+		{"normal, ties", []float64{1, 2, 2, 3, 4}, []float64{3, 4, 4, 5, 6}, 0.043220},
+		{"normal, ties across samples", []float64{1, 1, 1, 2, 2}, []float64{2, 3, 3, 3, 3, 4}, 0.010105},
+		{"all equal", []float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+		{"empty sample", nil, []float64{1, 2}, 1},
+	}
+	for _, tt := range tests {
+		if got := mannWhitneyP(tt.a, tt.b); !approx(got, tt.want) {
+			t.Errorf("%s: p = %.6g, want %.6g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExactMannWhitneyP(t *testing.T) {
+	tests := []struct {
+		n1, n2, u int
+		want      float64
+	}{
+		{5, 5, 0, 2.0 / 252},
+		{5, 5, 25, 2.0 / 252},
+		{3, 3, 1, 4.0 / 20},
+		{3, 3, 4, 1},
+		{1, 1, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := exactMannWhitneyP(tt.n1, tt.n2, tt.u); !approx(got, tt.want) {
+			t.Errorf("exactMannWhitneyP(%d, %d, %d) = %.6g, want %.6g", tt.n1, tt.n2, tt.u, got, tt.want)
+		}
+	}
+}
+
+func TestMinMannWhitneyP(t *testing.T) {
+	tests := []struct {
+		n1, n2 int
+		want   float64
+	}{
+		{1, 1, 1},
+		{3, 3, 0.1},
+		{5, 5, 2.0 / 252},
+		{0, 5, 1},
+	}
+	for _, tt := range tests {
+		if got := minMannWhitneyP(tt.n1, tt.n2); !approx(got, tt.want) {
+			t.Errorf("minMannWhitneyP(%d, %d) = %.6g, want %.6g", tt.n1, tt.n2, got, tt.want)
+		}
+	}
+	if got := minMannWhitneyP(30, 30); got != 0 {
+		t.Errorf("minMannWhitneyP(30, 30) = %g, want 0", got)
+	}
+}
+
+func approx(got, want float64) bool {
+	return math.Abs(got-want) <= 1e-4*want
+}
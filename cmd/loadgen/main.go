@@ -0,0 +1,165 @@
+// Command loadgen drives an issuer with a population of simulated clients.
+// Arrivals follow a configurable rate profile; each arrival is an issuance,
+// a redemption or a deliberate double-spend attempt by a random client. It
+// reports throughput and latency percentiles per operation.
+//
+// The issuer runs in-process by default, or is reached over HTTP (see
+// 'ppassrc serve') with -target and -pub.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ppassrc/ppassrc"
+)
+
+func main() {
+	targetURL := flag.String("target", "", "issuer base URL, e.g. http://localhost:8080 (in-process issuer when empty)")
+	pubPath := flag.String("pub", "", "issuer public key file, required with -target")
+	clients := flag.Int("clients", 1000, "number of simulated clients")
+	prefill := flag.Int("prefill", 1, "tokens issued to every client before the run")
+	duration := flag.Duration("duration", 10*time.Second, "length of the run")
+	rate := flag.Float64("rate", 200, "peak arrival rate in operations per second")
+	profileName := flag.String("profile", "constant", "arrival-rate profile ("+strings.Join(profileNames(), ", ")+")")
+	redeemRatio := flag.Float64("redeem-ratio", 1, "redemptions per issuance")
+	doubleSpend := flag.Float64("double-spend", 0.01, "fraction of redemptions that replay an already spent token")
+	workers := flag.Int("workers", 64, "maximum concurrent operations")
+	timeout := flag.Duration("timeout", 5*time.Second, "per-operation timeout")
+	hctx := flag.Int("hctx", int(ppassrc.HctxV2), "Hctx encoding version (1 or 2); must match the issuer's")
+	rctx := flag.String("context", "loadgen", "redemption context")
+	seed := flag.Int64("seed", 1, "seed for arrival times and operation mix")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	switch {
+	case *clients <= 0 || *workers <= 0 || *rate <= 0 || *duration <= 0:
+		log.Fatal("-clients, -workers, -rate and -duration must be positive")
+	case *redeemRatio < 0 || *doubleSpend < 0 || *doubleSpend > 1:
+		log.Fatal("-redeem-ratio must be non-negative and -double-spend within [0, 1]")
+	case *hctx != int(ppassrc.HctxV1) && *hctx != int(ppassrc.HctxV2):
+		log.Fatalf("unsupported -hctx version %d", *hctx)
+	}
+	prof, err := lookupProfile(*profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	v := ppassrc.HctxVersion(*hctx)
+	tgt, pk, name, err := openTarget(*targetURL, *pubPath, v, *workers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rec := newRecorder()
+	sim := &simulation{target: tgt, rctx: ppassrc.NewContext([]byte(*rctx)), timeout: *timeout, rec: rec}
+	population, err := newPopulation(sim, pk, v, *clients, *prefill, *workers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	pick := picker(rng, population, *redeemRatio, *doubleSpend)
+	start := time.Now()
+	sim.drive(context.Background(), rng, prof, *rate, *duration, *workers, pick)
+
+	rep := rec.report(time.Since(start))
+	rep.Target, rep.Profile, rep.PeakRate, rep.Clients = name, *profileName, *rate, *clients
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rep)
+	} else {
+		err = rep.writeText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if rep.Forgeries > 0 {
+		os.Exit(1)
+	}
+}
+
+// openTarget returns the issuer under test and its public key.
+func openTarget(url, pubPath string, v ppassrc.HctxVersion, workers int) (target, []byte, string, error) {
+	if url == "" {
+		iss, err := ppassrc.NewIssuer(ppassrc.WithHctxVersion(v))
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return iss, iss.VerificationKey(), "in-process", nil
+	}
+
+	if pubPath == "" {
+		return nil, nil, "", errors.New("-pub is required with -target")
+	}
+	raw, err := os.ReadFile(pubPath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(raw)))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("decoding %s: %w", pubPath, err)
+	}
+	pk, err := ppassrc.UnmarshalPublicKey(data)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	hc := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: workers}}
+	return ppassrc.NewHTTPIssuer(url, hc), pk, url, nil
+}
+
+// newPopulation creates the simulated clients and issues each its prefill
+// tokens, outside of the measurements.
+func newPopulation(sim *simulation, pk []byte, v ppassrc.HctxVersion, n, prefill, workers int) ([]*simClient, error) {
+	population := make([]*simClient, n)
+	for i := range population {
+		c, err := ppassrc.NewClient(pk, ppassrc.WithClientHctxVersion(v))
+		if err != nil {
+			return nil, err
+		}
+		population[i] = &simClient{client: c}
+	}
+	if prefill <= 0 {
+		return population, nil
+	}
+
+	var wg sync.WaitGroup
+	var failed sync.Once
+	var firstErr error
+	next := make(chan *simClient)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range next {
+				for j := 0; j < prefill; j++ {
+					ctx, cancel := context.WithTimeout(context.Background(), sim.timeout)
+					res := sim.issue(ctx, c)
+					cancel()
+					if res != resultOK {
+						failed.Do(func() { firstErr = errors.New("prefill issuance failed; is the issuer reachable?") })
+					}
+				}
+			}
+		}()
+	}
+	for _, c := range population {
+		next <- c
+	}
+	close(next)
+	wg.Wait()
+	return population, firstErr
+}
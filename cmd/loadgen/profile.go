@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// profile is an arrival-rate shape: rate returns the fraction of the peak
+// rate to generate at elapsed time t into a run of length d.
+type profile struct {
+	summary string
+	rate    func(t, d time.Duration) float64
+}
+
+var profiles = map[string]profile{
+	"constant": {"steady arrivals at the peak rate", func(t, d time.Duration) float64 {
+		return 1
+	}},
+	"ramp": {"linear ramp from zero to the peak rate", func(t, d time.Duration) float64 {
+		return float64(t) / float64(d)
+	}},
+	"spike": {"20% of the peak rate with a full-rate spike in the middle tenth", func(t, d time.Duration) float64 {
+		if f := float64(t) / float64(d); f >= 0.45 && f < 0.55 {
+			return 1
+		}
+		return 0.2
+	}},
+	"sine": {"two daily-cycle-like waves between 10% and 100% of the peak rate", func(t, d time.Duration) float64 {
+		return 0.55 - 0.45*math.Cos(4*math.Pi*float64(t)/float64(d))
+	}},
+}
+
+func lookupProfile(name string) (profile, error) {
+	p, ok := profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("unknown profile %q (have %s)", name, strings.Join(profileNames(), ", "))
+	}
+	return p, nil
+}
+
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupProfile(t *testing.T) {
+	const d = 100 * time.Second
+	tests := []struct {
+		name string
+		at   time.Duration
+		want float64
+	}{
+		{"constant", 0, 1},
+		{"constant", 70 * time.Second, 1},
+		{"ramp", 0, 0},
+		{"ramp", 25 * time.Second, 0.25},
+		{"spike", 10 * time.Second, 0.2},
+		{"spike", 50 * time.Second, 1},
+		{"spike", 55 * time.Second, 0.2},
+		{"sine", 0, 0.1},
+		{"sine", 25 * time.Second, 1},
+		{"sine", 50 * time.Second, 0.1},
+	}
+	for _, tt := range tests {
+		p, err := lookupProfile(tt.name)
+		if err != nil {
+			t.Fatalf("lookupProfile(%q): %v", tt.name, err)
+		}
+		if got := p.rate(tt.at, d); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s at %v: rate %.3f, want %.3f", tt.name, tt.at, got, tt.want)
+		}
+	}
+
+	_, err := lookupProfile("burst")
+	if err == nil || !strings.Contains(err.Error(), strings.Join(profileNames(), ", ")) {
+		t.Errorf("unknown profile: err = %v, want the list of profiles", err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"ppassrc/ppassrc"
+)
+
+// target is the issuer under load.
+type target interface {
+	IssueContext(ctx context.Context, b ppassrc.BlindedToken) (*ppassrc.Evaluation, error)
+	RedeemContext(ctx context.Context, rctx ppassrc.Context, tok *ppassrc.Token) (bool, error)
+}
+
+// simClient is one simulated user: a protocol client with a wallet of
+// unspent tokens and the tokens it already redeemed, which it may replay.
+type simClient struct {
+	mu     sync.Mutex // a user runs one operation at a time
+	client *ppassrc.Client
+	wallet []*ppassrc.Token
+	spent  []*ppassrc.Token
+}
+
+// maxSpentKept bounds the replay candidates each simulated client keeps.
+const maxSpentKept = 8
+
+// arrival is one scheduled operation. Double-spend arrivals fall back to a
+// normal redemption when the client has nothing to replay yet.
+type arrival struct {
+	client *simClient
+	op     string
+	replay float64 // which spent token a double spend replays, in [0, 1)
+}
+
+// picker returns a function drawing arrivals from rng: a random client of
+// population, redeeming with the odds given by redeemRatio, and replaying a
+// spent token in a doubleSpend fraction of redemptions. Everything random
+// about an arrival is drawn here so that the seed alone fixes the mix.
+func picker(rng *rand.Rand, population []*simClient, redeemRatio, doubleSpend float64) func() arrival {
+	pRedeem := redeemRatio / (1 + redeemRatio)
+	return func() arrival {
+		a := arrival{client: population[rng.Intn(len(population))], op: opIssue}
+		if rng.Float64() < pRedeem {
+			a.op = opRedeem
+			if rng.Float64() < doubleSpend {
+				a.op = opDoubleSpend
+				a.replay = rng.Float64()
+			}
+		}
+		return a
+	}
+}
+
+type simulation struct {
+	target  target
+	rctx    ppassrc.Context
+	timeout time.Duration
+	rec     *recorder
+}
+
+func (s *simulation) run(a arrival) {
+	c := a.client
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	op := a.op
+	if op == opDoubleSpend && len(c.spent) == 0 {
+		op = opRedeem
+	}
+	if op == opRedeem && len(c.wallet) == 0 {
+		s.rec.emptyWallet()
+		op = opIssue
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	var res result
+	switch op {
+	case opIssue:
+		res = s.issue(ctx, c)
+	case opRedeem:
+		tok := c.wallet[len(c.wallet)-1]
+		c.wallet = c.wallet[:len(c.wallet)-1]
+		res = s.redeem(ctx, tok)
+		if res != resultError {
+			c.spent = append(c.spent, tok)
+			if len(c.spent) > maxSpentKept {
+				c.spent = c.spent[1:]
+			}
+		}
+	case opDoubleSpend:
+		res = s.redeem(ctx, c.spent[int(a.replay*float64(len(c.spent)))])
+	}
+	s.rec.record(op, res, time.Since(start))
+}
+
+// issue runs the full client-side issuance: Request, the issuer round trip
+// and Finalize.
+func (s *simulation) issue(ctx context.Context, c *simClient) result {
+	b, aux, err := c.client.RequestContext(ctx, s.rctx)
+	if err != nil {
+		return resultError
+	}
+	eval, err := s.target.IssueContext(ctx, b)
+	switch {
+	case errors.Is(err, ppassrc.ErrIssuanceRejected), errors.Is(err, ppassrc.ErrAttestationFailed):
+		return resultRejected
+	case err != nil:
+		return resultError
+	}
+	tok, err := c.client.FinalizeContext(ctx, eval, aux)
+	if err != nil {
+		return resultError
+	}
+	c.wallet = append(c.wallet, tok)
+	return resultOK
+}
+
+func (s *simulation) redeem(ctx context.Context, tok *ppassrc.Token) result {
+	ok, err := s.target.RedeemContext(ctx, s.rctx, tok)
+	switch {
+	case err != nil:
+		return resultError
+	case !ok:
+		return resultRejected
+	}
+	return resultOK
+}
+
+// drive runs arrivals from pick on the given number of workers until
+// generate is done with the run.
+func (s *simulation) drive(ctx context.Context, rng *rand.Rand, p profile, peak float64, d time.Duration, workers int, pick func() arrival) {
+	jobs := make(chan arrival)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range jobs {
+				s.run(a)
+			}
+		}()
+	}
+	generate(ctx, rng, p, peak, d, pick, jobs, s.rec)
+	close(jobs)
+	wg.Wait()
+}
+
+// generate schedules arrivals following p for duration d as a
+// non-homogeneous Poisson process with the given peak rate (thinning), and
+// hands them to jobs without blocking; arrivals that find every worker busy
+// are dropped and counted.
+func generate(ctx context.Context, rng *rand.Rand, p profile, peak float64, d time.Duration, pick func() arrival, jobs chan<- arrival, rec *recorder) {
+	start := time.Now()
+	next := time.Duration(0)
+	for {
+		next += time.Duration(rng.ExpFloat64() / peak * float64(time.Second))
+		if next >= d {
+			return
+		}
+		if rng.Float64() >= p.rate(next, d) {
+			continue
+		}
+
+		if wait := time.Until(start.Add(next)); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case jobs <- pick():
+		default:
+			rec.drop()
+		}
+	}
+}
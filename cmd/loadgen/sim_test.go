@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"ppassrc/ppassrc"
+)
+
+// A short run against an in-process issuer exercises every operation and
+// never gets a replayed token accepted.
+func TestSimulation(t *testing.T) {
+	tgt, pk, _, err := openTarget("", "", ppassrc.HctxV2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := newRecorder()
+	sim := &simulation{target: tgt, rctx: ppassrc.NewContext([]byte("loadgen")), timeout: 5 * time.Second, rec: rec}
+	population, err := newPopulation(sim, pk, ppassrc.HctxV2, 8, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	prof, _ := lookupProfile("constant")
+	sim.drive(context.Background(), rng, prof, 400, 300*time.Millisecond, 4, picker(rng, population, 3, 0.3))
+
+	rep := rec.report(time.Second)
+	counts := make(map[string]opReport)
+	for _, o := range rep.Ops {
+		counts[o.Op] = o
+		if o.Errors > 0 {
+			t.Errorf("%s: %d errors", o.Op, o.Errors)
+		}
+	}
+	for _, op := range opOrder {
+		if counts[op].Count == 0 {
+			t.Errorf("no %s operations in the run", op)
+		}
+	}
+	if rep.Forgeries != 0 || counts[opDoubleSpend].Rejected != counts[opDoubleSpend].Count {
+		t.Errorf("double spends: %+v, want all rejected", counts[opDoubleSpend])
+	}
+	if counts[opRedeem].Rejected != 0 {
+		t.Errorf("fresh tokens rejected: %+v", counts[opRedeem])
+	}
+}
+
+func TestPickerIsSeeded(t *testing.T) {
+	population := make([]*simClient, 16)
+	for i := range population {
+		population[i] = &simClient{}
+	}
+	draw := func() []arrival {
+		pick := picker(rand.New(rand.NewSource(7)), population, 1, 0.5)
+		as := make([]arrival, 50)
+		for i := range as {
+			as[i] = pick()
+		}
+		return as
+	}
+	a, b := draw(), draw()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("arrival %d differs between runs with the same seed: %+v, %+v", i, a[i], b[i])
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Operation kinds, in report order.
+const (
+	opIssue       = "issue"
+	opRedeem      = "redeem"
+	opDoubleSpend = "double-spend"
+)
+
+var opOrder = []string{opIssue, opRedeem, opDoubleSpend}
+
+// result classifies a completed operation.
+type result int
+
+const (
+	resultOK       result = iota // issued, or redeemed
+	resultRejected               // the issuer refused (expected for double spends)
+	resultError                  // transport or server failure
+)
+
+type opStats struct {
+	latencies []time.Duration
+	counts    [3]int
+}
+
+// recorder collects per-operation latencies and results.
+type recorder struct {
+	mu      sync.Mutex
+	ops     map[string]*opStats
+	dropped int
+	noToken int
+}
+
+func newRecorder() *recorder {
+	return &recorder{ops: make(map[string]*opStats)}
+}
+
+func (r *recorder) record(op string, res result, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.ops[op]
+	if !ok {
+		s = &opStats{}
+		r.ops[op] = s
+	}
+	s.counts[res]++
+	s.latencies = append(s.latencies, d)
+}
+
+func (r *recorder) drop() {
+	r.mu.Lock()
+	r.dropped++
+	r.mu.Unlock()
+}
+
+func (r *recorder) emptyWallet() {
+	r.mu.Lock()
+	r.noToken++
+	r.mu.Unlock()
+}
+
+// opReport summarizes one operation kind.
+type opReport struct {
+	Op         string  `json:"op"`
+	Count      int     `json:"count"`
+	OK         int     `json:"ok"`
+	Rejected   int     `json:"rejected"`
+	Errors     int     `json:"errors"`
+	Throughput float64 `json:"throughput_per_sec"`
+	P50        float64 `json:"p50_ms"`
+	P90        float64 `json:"p90_ms"`
+	P99        float64 `json:"p99_ms"`
+	Max        float64 `json:"max_ms"`
+}
+
+// report is the outcome of a run.
+type report struct {
+	Target    string     `json:"target"`
+	Profile   string     `json:"profile"`
+	PeakRate  float64    `json:"peak_rate_per_sec"`
+	Clients   int        `json:"clients"`
+	Elapsed   float64    `json:"elapsed_sec"`
+	Ops       []opReport `json:"ops"`
+	Dropped   int        `json:"dropped_arrivals"`
+	NoToken   int        `json:"redemptions_without_token"`
+	Forgeries int        `json:"accepted_double_spends"`
+}
+
+func (r *recorder) report(elapsed time.Duration) report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep := report{Elapsed: elapsed.Seconds(), Dropped: r.dropped, NoToken: r.noToken}
+	for _, op := range opOrder {
+		s, ok := r.ops[op]
+		if !ok {
+			continue
+		}
+		lat := append([]time.Duration(nil), s.latencies...)
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		rep.Ops = append(rep.Ops, opReport{
+			Op:         op,
+			Count:      len(lat),
+			OK:         s.counts[resultOK],
+			Rejected:   s.counts[resultRejected],
+			Errors:     s.counts[resultError],
+			Throughput: float64(len(lat)) / elapsed.Seconds(),
+			P50:        ms(percentile(lat, 0.50)),
+			P90:        ms(percentile(lat, 0.90)),
+			P99:        ms(percentile(lat, 0.99)),
+			Max:        ms(percentile(lat, 1)),
+		})
+		if op == opDoubleSpend {
+			rep.Forgeries = s.counts[resultOK]
+		}
+	}
+	return rep
+}
+
+// percentile returns the nearest-rank q-quantile of sorted latencies.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func ms(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+
+func (rep report) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "target %s, profile %s, peak %.0f arrivals/s, %d clients, %.1fs\n\n",
+		rep.Target, rep.Profile, rep.PeakRate, rep.Clients, rep.Elapsed)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcount\tok\trejected\terrors\tops/s\tp50 ms\tp90 ms\tp99 ms\tmax ms\t")
+	for _, o := range rep.Ops {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.1f\t%.3f\t%.3f\t%.3f\t%.3f\t\n",
+			o.Op, o.Count, o.OK, o.Rejected, o.Errors, o.Throughput, o.P50, o.P90, o.P99, o.Max)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	if rep.Dropped > 0 {
+		fmt.Fprintf(w, "dropped arrivals: %d (all workers busy; raise -workers or lower -rate)\n", rep.Dropped)
+	}
+	if rep.NoToken > 0 {
+		fmt.Fprintf(w, "redemptions replaced by issuance (empty wallet): %d\n", rep.NoToken)
+	}
+	if rep.Forgeries > 0 {
+		_, err := fmt.Fprintf(w, "ACCEPTED DOUBLE SPENDS: %d\n", rep.Forgeries)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"ppassrc/ppassrc"
+)
+
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: ppassrc %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func runKeygen(args []string) error {
+	fs := newFlagSet("keygen", "-out issuer.key [-pub issuer.pub]")
+	out := fs.String("out", "", "file to write the issuer key to (stdout when empty)")
+	pub := fs.String("pub", "", "file to write the public key to (optional)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	issuer, err := ppassrc.NewIssuer()
+	if err != nil {
+		return err
+	}
+	if err := writeMessage(*out, issuer.MarshalKey(), 0o600); err != nil {
+		return err
+	}
+	if *pub != "" {
+		if err := writeMessage(*pub, ppassrc.MarshalPublicKey(issuer.VerificationKey()), 0o644); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "key id %x\n", issuer.KeyID())
+	return nil
+}
+
+func runKeyinfo(args []string) error {
+	fs := newFlagSet("keyinfo", "[-in issuer.key|issuer.pub]")
+	in := fs.String("in", "", "issuer key or public key file (stdin when empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := readMessage(*in)
+	if err != nil {
+		return err
+	}
+
+	kind := "public key"
+	pk, err := ppassrc.UnmarshalPublicKey(data)
+	if err != nil {
+		issuer, keyErr := ppassrc.NewIssuerFromKey(data)
+		if keyErr != nil {
+			return fmt.Errorf("not a key file: %v", err)
+		}
+		kind = "issuer key (secret)"
+		pk = issuer.VerificationKey()
+	}
+
+	fmt.Printf("type:       %s\n", kind)
+	fmt.Printf("key id:     %x\n", ppassrc.KeyID(pk))
+	fmt.Printf("public key: %x\n", pk)
+	return nil
+}
+
+func loadPublicKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, errors.New("-pub is required")
+	}
+	data, err := readMessage(path)
+	if err != nil {
+		return nil, err
+	}
+	return ppassrc.UnmarshalPublicKey(data)
+}
+
+func loadIssuer(path string, opts ...ppassrc.IssuerOption) (*ppassrc.Issuer, error) {
+	if path == "" {
+		return nil, errors.New("-key is required")
+	}
+	data, err := readMessage(path)
+	if err != nil {
+		return nil, err
+	}
+	return ppassrc.NewIssuerFromKey(data, opts...)
+}
+
+func runRequest(args []string) error {
+	fs := newFlagSet("request", "-pub issuer.pub -context CTX -state request.state [-out blinded]")
+	pub := fs.String("pub", "", "issuer public key file")
+	state := fs.String("state", "", "file to write the secret request state to")
+	out := fs.String("out", "", "file to write the blinded token to (stdout when empty)")
+	ctxFlags := addContextFlags(fs)
+	hctx := addHctxFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *state == "" {
+		return errors.New("-state is required")
+	}
+	ctx, err := ctxFlags.context()
+	if err != nil {
+		return err
+	}
+	v, err := hctxVersion(*hctx)
+	if err != nil {
+		return err
+	}
+	pk, err := loadPublicKey(*pub)
+	if err != nil {
+		return err
+	}
+
+	client, err := ppassrc.NewClient(pk, ppassrc.WithClientHctxVersion(v))
+	if err != nil {
+		return err
+	}
+	blinded, aux, err := client.Request(ctx)
+	if err != nil {
+		return err
+	}
+
+	rawAux, err := aux.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := writeMessage(*state, rawAux, 0o600); err != nil {
+		return err
+	}
+	rawBlinded, err := blinded.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writeMessage(*out, rawBlinded, 0o644)
+}
+
+func runIssue(args []string) error {
+	fs := newFlagSet("issue", "-key issuer.key [-in blinded] [-out evaluation]")
+	key := fs.String("key", "", "issuer key file")
+	in := fs.String("in", "", "blinded token file (stdin when empty)")
+	out := fs.String("out", "", "file to write the evaluation to (stdout when empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	issuer, err := loadIssuer(*key)
+	if err != nil {
+		return err
+	}
+	data, err := readMessage(*in)
+	if err != nil {
+		return err
+	}
+	var blinded ppassrc.BlindedToken
+	if err := blinded.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	eval, err := issuer.Issue(blinded)
+	if err != nil {
+		return err
+	}
+	raw, err := eval.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writeMessage(*out, raw, 0o644)
+}
+
+func runFinalize(args []string) error {
+	fs := newFlagSet("finalize", "-pub issuer.pub -state request.state [-in evaluation] [-out token]")
+	pub := fs.String("pub", "", "issuer public key file")
+	state := fs.String("state", "", "request state file written by 'request'")
+	in := fs.String("in", "", "evaluation file (stdin when empty)")
+	out := fs.String("out", "", "file to write the token to (stdout when empty)")
+	hctx := addHctxFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *state == "" {
+		return errors.New("-state is required")
+	}
+	v, err := hctxVersion(*hctx)
+	if err != nil {
+		return err
+	}
+	pk, err := loadPublicKey(*pub)
+	if err != nil {
+		return err
+	}
+
+	rawAux, err := readMessage(*state)
+	if err != nil {
+		return err
+	}
+	var aux ppassrc.RequestAux
+	if err := aux.UnmarshalBinary(rawAux); err != nil {
+		return err
+	}
+	rawEval, err := readMessage(*in)
+	if err != nil {
+		return err
+	}
+	var eval ppassrc.Evaluation
+	if err := eval.UnmarshalBinary(rawEval); err != nil {
+		return err
+	}
+
+	client, err := ppassrc.NewClient(pk, ppassrc.WithClientHctxVersion(v))
+	if err != nil {
+		return err
+	}
+	tok, err := client.Finalize(&eval, aux)
+	if err != nil {
+		return err
+	}
+	raw, err := tok.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writeMessage(*out, raw, 0o600)
+}
+
+func runRedeem(args []string) error {
+	fs := newFlagSet("redeem", "(-key issuer.key -spent spent.txt | -url URL -pub issuer.pub) -context CTX [-in token]")
+	key := fs.String("key", "", "issuer key file")
+	spent := fs.String("spent", "", "spent token store (created if missing)")
+	url := fs.String("url", "", "issuer or verification service to redeem at instead of holding the key (see serve)")
+	pub := fs.String("pub", "", "issuer public key file, with -url")
+	in := fs.String("in", "", "token file (stdin when empty)")
+	ctxFlags := addContextFlags(fs)
+	hctx := addHctxFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, err := ctxFlags.context()
+	if err != nil {
+		return err
+	}
+	var redeemer interface {
+		Redeem(ppassrc.Context, *ppassrc.Token) (bool, error)
+	}
+	switch {
+	case *url != "" && (*key != "" || *spent != ""):
+		return errors.New("-url redeems at the server, which keeps the key and spent set; drop -key and -spent")
+	case *url != "":
+		pk, err := loadPublicKey(*pub)
+		if err != nil {
+			return err
+		}
+		redeemer = ppassrc.NewRemoteVerifier(*url, pk)
+	case *spent == "":
+		return errors.New("-spent is required")
+	default:
+		v, err := hctxVersion(*hctx)
+		if err != nil {
+			return err
+		}
+		issuer, err := loadIssuer(*key, ppassrc.WithHctxVersion(v), ppassrc.WithSpentStore(fileSpentStore{path: *spent}))
+		if err != nil {
+			return err
+		}
+		redeemer = issuer
+	}
+
+	data, err := readMessage(*in)
+	if err != nil {
+		return err
+	}
+	var tok ppassrc.Token
+	if err := tok.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	ok, err := redeemer.Redeem(ctx, &tok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("rejected")
+		return errRejected
+	}
+	fmt.Printf("accepted (context %s)\n", hex.EncodeToString(ctx))
+	return nil
+}
+
+func runInspect(args []string) error {
+	fs := newFlagSet("inspect", "[-in file] [-binary]")
+	in := fs.String("in", "", "message file (stdin when empty)")
+	binary := fs.Bool("binary", false, "input is raw binary rather than base64")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var data []byte
+	var err error
+	switch {
+	case !*binary:
+		data, err = readMessage(*in)
+	case *in == "" || *in == "-":
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		data, err = os.ReadFile(*in)
+	}
+	if err != nil {
+		return err
+	}
+
+	report := ppassrc.Inspect(data)
+	fmt.Print(report)
+	if !report.Valid() {
+		return errRejected
+	}
+	return nil
+}
+
+func runServe(args []string) error {
+	fs := newFlagSet("serve", "-key issuer.key [-redeem-only] [-addr :8080] [-spent spent.txt | -spent-url URL [-spent-secret-file F] | -redis host:port [redis flags]] [-metrics]")
+	key := fs.String("key", "", "issuer key file")
+	redeemOnly := fs.Bool("redeem-only", false, "serve only redemption, as the verification service for 'redeem -url'")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	spent := fs.String("spent", "", "spent token store (in memory when empty)")
+	spentURL := fs.String("spent-url", "", "shared spent store served by 'ppassrc spentd'")
+	spentSecret := fs.String("spent-secret-file", "", "file holding the secret of the -spent-url store (see spentd -secret-file)")
+	redis := fs.String("redis", "", "Redis server keeping the spent store")
+	redisTTL := fs.Duration("redis-ttl", 0, "how long Redis keeps spent tokens; 0 keeps them forever (default: long enough for -redis-window and -redis-grace)")
+	redisWindow := fs.Duration("redis-window", time.Hour, "length of the time windows tokens are redeemed in")
+	redisGrace := fs.Int("redis-grace", 1, "adjacent windows accepted on either side")
+	redisPassword := fs.String("redis-password-file", "", "file holding the Redis AUTH password")
+	redisDB := fs.Int("redis-db", 0, "Redis database number")
+	metrics := fs.Bool("metrics", false, "serve Prometheus metrics on /metrics")
+	hctx := addHctxFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	v, err := hctxVersion(*hctx)
+	if err != nil {
+		return err
+	}
+	opts := []ppassrc.IssuerOption{ppassrc.WithHctxVersion(v)}
+	stores := 0
+	for _, v := range []string{*spent, *spentURL, *redis} {
+		if v != "" {
+			stores++
+		}
+	}
+	switch {
+	case stores > 1:
+		return errors.New("-spent, -spent-url and -redis are mutually exclusive")
+	case *spentSecret != "" && *spentURL == "":
+		return errors.New("-spent-secret-file requires -spent-url")
+	case *redis == "" && setFlags(fs, "redis-ttl", "redis-window", "redis-grace", "redis-password-file", "redis-db"):
+		return errors.New("-redis-ttl, -redis-window, -redis-grace, -redis-password-file and -redis-db require -redis")
+	case *spent != "":
+		opts = append(opts, ppassrc.WithSpentStore(&lockedSpentStore{store: fileSpentStore{path: *spent}}))
+	case *spentURL != "":
+		var storeOpts []ppassrc.HTTPSpentStoreOption
+		if *spentSecret != "" {
+			secret, err := readSecret(*spentSecret)
+			if err != nil {
+				return err
+			}
+			storeOpts = append(storeOpts, ppassrc.WithHTTPSpentStoreSecret(secret))
+		}
+		opts = append(opts, ppassrc.WithSpentStore(ppassrc.NewHTTPSpentStore(*spentURL, nil, storeOpts...)))
+	case *redis != "":
+		if *redisWindow <= 0 || *redisGrace < 0 || *redisTTL < 0 {
+			return errors.New("-redis-window must be positive and -redis-grace and -redis-ttl non-negative")
+		}
+		ttl := *redisTTL
+		if !setFlags(fs, "redis-ttl") {
+			ttl = ppassrc.SpentTTL(*redisWindow, *redisGrace)
+		}
+		redisOpts := []ppassrc.RedisOption{ppassrc.WithRedisDB(*redisDB)}
+		if *redisPassword != "" {
+			password, err := readSecret(*redisPassword)
+			if err != nil {
+				return err
+			}
+			redisOpts = append(redisOpts, ppassrc.WithRedisPassword(password))
+		}
+		opts = append(opts, ppassrc.WithSpentStore(ppassrc.NewRedisSpentStore(*redis, ttl, redisOpts...)))
+	}
+	var m *ppassrc.Metrics
+	if *metrics {
+		m = ppassrc.NewMetrics()
+		opts = append(opts, ppassrc.WithInstrumentation(m))
+	}
+	issuer, err := loadIssuer(*key, opts...)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	if *redeemOnly {
+		mux.Handle(ppassrc.RedeemPath, ppassrc.NewVerifierHandler(issuer.Verifier))
+		log.Printf("serving redemption only")
+	} else {
+		h := ppassrc.NewHTTPHandler(issuer)
+		mux.Handle(ppassrc.IssuePath, h)
+		mux.Handle(ppassrc.RedeemPath, h)
+	}
+	if m != nil {
+		mux.Handle("/metrics", m)
+	}
+	log.Printf("serving key id %x on %s", issuer.KeyID(), *addr)
+	return http.ListenAndServe(*addr, mux)
+}
+
+func runSpentd(args []string) error {
+	fs := newFlagSet("spentd", "[-addr :8081] [-spent spent.txt] [-secret-file F]")
+	addr := fs.String("addr", ":8081", "address to listen on")
+	spent := fs.String("spent", "", "spent token store (in memory when empty)")
+	secretFile := fs.String("secret-file", "", "file holding a secret clients must send (without one, keep -addr private)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var store ppassrc.SpentStore = ppassrc.NewMemorySpentStore()
+	if *spent != "" {
+		store = &lockedSpentStore{store: fileSpentStore{path: *spent}}
+	}
+	var opts []ppassrc.SpentStoreHandlerOption
+	if *secretFile != "" {
+		secret, err := readSecret(*secretFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, ppassrc.WithSpentStoreSecret(secret))
+	} else {
+		log.Printf("no -secret-file: anyone who can reach %s can spend tokens", *addr)
+	}
+	log.Printf("serving spent store on %s", *addr)
+	return http.ListenAndServe(*addr, ppassrc.NewSpentStoreHandler(store, opts...))
+}
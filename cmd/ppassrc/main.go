@@ -0,0 +1,190 @@
+// Command ppassrc runs the individual PPass-RC protocol steps, reading and
+// writing base64-encoded messages from files or stdin/stdout so that issuance
+// and redemption can be scripted and debugged by hand.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"ppassrc/ppassrc"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"keygen":   {"generate an issuer key pair", runKeygen},
+	"keyinfo":  {"show the key ID and public key of a key file", runKeyinfo},
+	"request":  {"create a blinded token request for a context", runRequest},
+	"issue":    {"evaluate a blinded token request with an issuer key", runIssue},
+	"finalize": {"unblind an evaluation into a token", runFinalize},
+	"redeem":   {"redeem a token against a persistent spent store", runRedeem},
+	"inspect":  {"decode and validate any protocol message or key", runInspect},
+	"serve":    {"serve issuance and redemption over HTTP", runServe},
+	"spentd":   {"serve a spent store shared by several redeemers", runSpentd},
+}
+
+// errRejected is returned by subcommands whose check did not pass; it exits
+// non-zero without being reported as a failure.
+var errRejected = errors.New("rejected")
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "ppassrc: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if errors.Is(err, errRejected) {
+			os.Exit(1)
+		}
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "ppassrc %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: ppassrc <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'ppassrc <command> -h' for the flags of a command.")
+}
+
+// readMessage reads a base64-encoded message from path, or stdin when path
+// is "" or "-".
+func readMessage(path string) ([]byte, error) {
+	var raw []byte
+	var err error
+	if path == "" || path == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raw = bytes.TrimSpace(raw)
+	out := make([]byte, base64.StdEncoding.DecodedLen(len(raw)))
+	n, err := base64.StdEncoding.Decode(out, raw)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", displayPath(path), err)
+	}
+	return out[:n], nil
+}
+
+// writeMessage writes msg base64-encoded to path, or stdout when path is ""
+// or "-". Files are created with the given permissions.
+func writeMessage(path string, msg []byte, perm os.FileMode) error {
+	line := base64.StdEncoding.EncodeToString(msg) + "\n"
+	if path == "" || path == "-" {
+		_, err := io.WriteString(os.Stdout, line)
+		return err
+	}
+	return os.WriteFile(path, []byte(line), perm)
+}
+
+func displayPath(path string) string {
+	if path == "" || path == "-" {
+		return "stdin"
+	}
+	return path
+}
+
+// setFlags reports whether any of the named flags was set on the command
+// line.
+func setFlags(fs *flag.FlagSet, names ...string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			set = set || f.Name == name
+		}
+	})
+	return set
+}
+
+// readSecret reads a shared secret from the file at path, ignoring
+// surrounding whitespace.
+func readSecret(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(raw))
+	if secret == "" {
+		return "", fmt.Errorf("%s holds no secret", path)
+	}
+	return secret, nil
+}
+
+// contextFlags registers the flags selecting a redemption context.
+type contextFlags struct {
+	text *string
+	hex  *string
+}
+
+func addContextFlags(fs *flag.FlagSet) contextFlags {
+	return contextFlags{
+		text: fs.String("context", "", "redemption context as a literal string"),
+		hex:  fs.String("context-hex", "", "redemption context as hex"),
+	}
+}
+
+func (cf contextFlags) context() (ppassrc.Context, error) {
+	switch {
+	case *cf.text != "" && *cf.hex != "":
+		return nil, errors.New("-context and -context-hex are mutually exclusive")
+	case *cf.hex != "":
+		b, err := hex.DecodeString(strings.TrimSpace(*cf.hex))
+		if err != nil {
+			return nil, fmt.Errorf("-context-hex: %w", err)
+		}
+		return ppassrc.NewContext(b), nil
+	case *cf.text != "":
+		return ppassrc.NewContext([]byte(*cf.text)), nil
+	default:
+		return nil, errors.New("a context is required (-context or -context-hex)")
+	}
+}
+
+func addHctxFlag(fs *flag.FlagSet) *int {
+	return fs.Int("hctx", int(ppassrc.HctxV2), "Hctx encoding version (1 or 2); must match between request, finalize and redeem")
+}
+
+func hctxVersion(v int) (ppassrc.HctxVersion, error) {
+	switch ppassrc.HctxVersion(v) {
+	case ppassrc.HctxV1, ppassrc.HctxV2:
+		return ppassrc.HctxVersion(v), nil
+	default:
+		return 0, fmt.Errorf("unsupported -hctx version %d", v)
+	}
+}
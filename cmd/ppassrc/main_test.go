@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+// A token goes through every step of the protocol as separate invocations,
+// with all state passed in files.
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+	run := func(cmd func([]string) error, args ...string) error {
+		t.Helper()
+		return cmd(args)
+	}
+	must := func(cmd func([]string) error, args ...string) {
+		t.Helper()
+		if err := run(cmd, args...); err != nil {
+			t.Fatalf("%s: %v", args, err)
+		}
+	}
+
+	must(runKeygen, "-out", file("issuer.key"), "-pub", file("issuer.pub"))
+	must(runKeyinfo, "-in", file("issuer.pub"))
+	must(runRequest, "-pub", file("issuer.pub"), "-context", "example.com", "-state", file("request.state"), "-out", file("blinded"))
+	must(runIssue, "-key", file("issuer.key"), "-in", file("blinded"), "-out", file("evaluation"))
+
+	err := run(runFinalize, "-pub", file("issuer.pub"), "-state", file("request.state"), "-in", file("evaluation"), "-out", file("token"), "-hctx", "1")
+	if !errors.Is(err, ppassrc.ErrStateMismatch) {
+		t.Fatalf("finalize under another Hctx version: err = %v, want ErrStateMismatch", err)
+	}
+	must(runFinalize, "-pub", file("issuer.pub"), "-state", file("request.state"), "-in", file("evaluation"), "-out", file("token"))
+
+	redeem := func(ctx string) error {
+		return run(runRedeem, "-key", file("issuer.key"), "-context", ctx, "-spent", file("spent.txt"), "-in", file("token"))
+	}
+	if err := redeem("other.example"); !errors.Is(err, errRejected) {
+		t.Fatalf("redeem under another context: err = %v, want errRejected", err)
+	}
+	if err := redeem("example.com"); err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+	if err := redeem("example.com"); !errors.Is(err, errRejected) {
+		t.Fatalf("second redeem: err = %v, want errRejected", err)
+	}
+}
+
+func TestServeSpentStoresExclusive(t *testing.T) {
+	for _, args := range [][]string{
+		{"-spent", "spent.txt", "-spent-url", "http://127.0.0.1:8081"},
+		{"-spent", "spent.txt", "-redis", "127.0.0.1:6379"},
+		{"-spent-url", "http://127.0.0.1:8081", "-redis", "127.0.0.1:6379"},
+	} {
+		err := runServe(append([]string{"-key", "issuer.key", "-addr", "127.0.0.1:0"}, args...))
+		if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+			t.Errorf("serve %s: err = %v, want a mutual-exclusion error", args, err)
+		}
+	}
+}
+
+func TestServeSpentSecretRequiresURL(t *testing.T) {
+	err := runServe([]string{"-key", "issuer.key", "-addr", "127.0.0.1:0", "-spent-secret-file", "spent.secret"})
+	if err == nil || !strings.Contains(err.Error(), "requires -spent-url") {
+		t.Errorf("serve -spent-secret-file without -spent-url: err = %v", err)
+	}
+}
+
+func TestServeRedisFlagsRequireRedis(t *testing.T) {
+	for _, args := range [][]string{{"-redis-ttl", "1h"}, {"-redis-db", "1"}} {
+		err := runServe(append([]string{"-key", "issuer.key", "-addr", "127.0.0.1:0"}, args...))
+		if err == nil || !strings.Contains(err.Error(), "require -redis") {
+			t.Errorf("serve %s without -redis: err = %v", args, err)
+		}
+	}
+}
+
+// redeem -url holds no key: the server decides and keeps the spent set.
+func TestRedeemRemote(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+	issuer, _ := ppassrc.NewIssuer()
+	srv := httptest.NewServer(ppassrc.NewVerifierHandler(issuer.Verifier))
+	defer srv.Close()
+
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("example.com"))
+	b, aux, _ := client.Request(rctx)
+	ev, _ := issuer.Issue(b)
+	tok, err := client.Finalize(ev, aux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := tok.MarshalBinary()
+	if err := writeMessage(file("token"), raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMessage(file("issuer.pub"), ppassrc.MarshalPublicKey(issuer.VerificationKey()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	redeem := func(extra ...string) error {
+		return runRedeem(append([]string{"-url", srv.URL, "-pub", file("issuer.pub"), "-context", "example.com", "-in", file("token")}, extra...))
+	}
+	if err := redeem("-key", file("issuer.key")); err == nil || !strings.Contains(err.Error(), "-url") {
+		t.Fatalf("-url with -key: err = %v, want an error naming -url", err)
+	}
+	if err := redeem(); err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+	if err := redeem(); !errors.Is(err, errRejected) {
+		t.Fatalf("second redeem: err = %v, want errRejected", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// fileSpentStore is an append-only text file holding one hex-encoded spent
+// token value per line. It does no locking and is meant for one ppassrc
+// process at a time.
+type fileSpentStore struct {
+	path string
+}
+
+func (s fileSpentStore) Spend(key []byte) (bool, error) {
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	want := hex.EncodeToString(key)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) == want {
+			return false, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return false, fmt.Errorf("reading spent store: %w", err)
+	}
+
+	if _, err := fmt.Fprintln(f, want); err != nil {
+		return false, fmt.Errorf("writing spent store: %w", err)
+	}
+	return true, f.Sync()
+}
+
+// lockedSpentStore serializes access to a store that does no locking of its
+// own, for use by the concurrent HTTP server.
+type lockedSpentStore struct {
+	mu    sync.Mutex
+	store fileSpentStore
+}
+
+func (s *lockedSpentStore) Spend(key []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Spend(key)
+}
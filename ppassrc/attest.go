@@ -0,0 +1,128 @@
+package ppassrc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// ErrAttestationFailed is wrapped by every error an attester returns when the
+// presented evidence does not satisfy it.
+var ErrAttestationFailed = errors.New("ppassrc: attestation failed")
+
+// Evidence is the request-scoped attestation material presented alongside an
+// issuance request, keyed by evidence type ("captcha", "device", ...).
+type Evidence map[string][]byte
+
+// Attester decides whether the evidence presented with an issuance request
+// entitles the client to a token.
+type Attester interface {
+	Attest(ev Evidence) error
+}
+
+// AttesterContext is implemented by attesters that can block, such as ones
+// that call out to a verification service. AttestContext must give up and
+// return ctx's error once ctx is done; the request is then rejected.
+type AttesterContext interface {
+	Attester
+	AttestContext(ctx context.Context, ev Evidence) error
+}
+
+// attestContext calls a.AttestContext when a supports it and otherwise checks
+// ctx before the plain Attest.
+func attestContext(ctx context.Context, a Attester, ev Evidence) error {
+	if ac, ok := a.(AttesterContext); ok {
+		return ac.AttestContext(ctx, ev)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Attest(ev)
+}
+
+// attesterContextFunc adapts a function to the AttesterContext interface.
+type attesterContextFunc func(ctx context.Context, ev Evidence) error
+
+func (f attesterContextFunc) Attest(ev Evidence) error { return f(context.Background(), ev) }
+
+func (f attesterContextFunc) AttestContext(ctx context.Context, ev Evidence) error {
+	return f(ctx, ev)
+}
+
+// AttesterFunc adapts a function to the Attester interface.
+type AttesterFunc func(ev Evidence) error
+
+// Attest calls f(ev).
+func (f AttesterFunc) Attest(ev Evidence) error { return f(ev) }
+
+// AllOf returns an attester that succeeds only if every attester in as does.
+// Like AnyOf, it rejects every request when as is empty. The returned
+// attester implements AttesterContext and passes the context on to each of
+// as in turn.
+func AllOf(as ...Attester) Attester {
+	return attesterContextFunc(func(ctx context.Context, ev Evidence) error {
+		if len(as) == 0 {
+			return fmt.Errorf("%w: no attesters configured", ErrAttestationFailed)
+		}
+		for _, a := range as {
+			if err := attestContext(ctx, a, ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AnyOf returns an attester that succeeds as soon as one attester in as does.
+// If all of them fail, the returned error joins their errors. Like AllOf, the
+// returned attester implements AttesterContext; once ctx is done it stops
+// trying and returns ctx's error.
+func AnyOf(as ...Attester) Attester {
+	return attesterContextFunc(func(ctx context.Context, ev Evidence) error {
+		if len(as) == 0 {
+			return fmt.Errorf("%w: no attesters configured", ErrAttestationFailed)
+		}
+		errs := make([]error, 0, len(as))
+		for _, a := range as {
+			err := attestContext(ctx, a, ev)
+			if err == nil {
+				return nil
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// TestAttester accepts evidence of a single type whose payload matches one of
+// a fixed set of values. It is meant for tests and local development.
+type TestAttester struct {
+	kind     string
+	accepted [][]byte
+}
+
+// NewTestAttester returns a TestAttester for evidence of the given type.
+func NewTestAttester(kind string, accepted ...[]byte) *TestAttester {
+	return &TestAttester{
+		kind:     kind,
+		accepted: accepted,
+	}
+}
+
+// Attest implements Attester.
+func (t *TestAttester) Attest(ev Evidence) error {
+	payload, ok := ev[t.kind]
+	if !ok {
+		return fmt.Errorf("%w: missing %s evidence", ErrAttestationFailed, t.kind)
+	}
+	for _, want := range t.accepted {
+		if subtle.ConstantTimeCompare(payload, want) == 1 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: invalid %s evidence", ErrAttestationFailed, t.kind)
+}
@@ -0,0 +1,184 @@
+package ppassrc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrAuditLogTampered is wrapped by every error VerifyAuditLog returns for a
+// log whose entries were altered, reordered or deleted.
+var ErrAuditLogTampered = errors.New("ppassrc: audit log tampered")
+
+// auditEntry is one line of the audit log. Hash chains the entry to its
+// predecessor: Hash = H(Prev || Seq || Time || Op || KeyID || Outcome ||
+// ContextDigest), where H is SHA-256, or HMAC-SHA256 when the log is keyed.
+type auditEntry struct {
+	Seq           uint64    `json:"seq"`
+	Time          time.Time `json:"time"`
+	Op            string    `json:"op"`
+	KeyID         string    `json:"key_id"`
+	Outcome       Outcome   `json:"outcome"`
+	ContextDigest string    `json:"context_digest,omitempty"`
+	Prev          string    `json:"prev"`
+	Hash          string    `json:"hash"`
+}
+
+// AuditHead identifies the last entry of an audit log. Anchoring it outside
+// the log (e.g. in a separate system) makes truncation detectable too.
+type AuditHead struct {
+	Entries uint64
+	Hash    []byte
+}
+
+// AuditLog writes issuer events as hash-chained JSON lines. Each entry
+// commits to the previous one, so VerifyAuditLog detects altered, reordered
+// or deleted entries. Without a key anyone able to rewrite the whole file can
+// recompute the chain; with a key the chain is an HMAC chain that cannot be
+// recomputed without it.
+type AuditLog struct {
+	mu   sync.Mutex
+	w    io.Writer
+	key  []byte
+	head AuditHead
+	err  error
+}
+
+// NewAuditLog starts a new audit log on w. key may be nil.
+func NewAuditLog(w io.Writer, key []byte) *AuditLog {
+	return ResumeAuditLog(w, key, AuditHead{})
+}
+
+// ResumeAuditLog continues an existing log whose last entry is head, as
+// returned by VerifyAuditLog.
+func ResumeAuditLog(w io.Writer, key []byte, head AuditHead) *AuditLog {
+	if head.Hash == nil {
+		head.Hash = make([]byte, sha256.Size)
+	}
+	return &AuditLog{w: w, key: key, head: head}
+}
+
+// Hook returns an EventHook that records every event. It fails open: write
+// errors are kept and reported by Err, and the operations carry on
+// unrecorded. Use WithAuditLog to fail them instead.
+func (l *AuditLog) Hook() EventHook {
+	return func(ev Event) { _ = l.Record(ev) }
+}
+
+// WithAuditLog records every issuer or verifier decision in l, failing
+// closed: an issuance that cannot be recorded returns the write error instead
+// of the evaluation, and a token accepted but not recorded is rejected with
+// the error; it stays spent. The event is reported to instrumentation and
+// hooks with OutcomeError.
+func WithAuditLog(l *AuditLog) IssuerOption {
+	return func(iss *Issuer) { iss.audits = append(iss.audits, l) }
+}
+
+// Record appends ev to the log.
+func (l *AuditLog) Record(ev Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := auditEntry{
+		Seq:           l.head.Entries + 1,
+		Time:          ev.Time.UTC(),
+		Op:            ev.Op,
+		KeyID:         ev.KeyID,
+		Outcome:       ev.Outcome,
+		ContextDigest: ev.ContextDigest,
+		Prev:          hex.EncodeToString(l.head.Hash),
+	}
+	sum := auditHash(l.key, l.head.Hash, &e)
+	e.Hash = hex.EncodeToString(sum)
+
+	line, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		if l.err == nil {
+			l.err = err
+		}
+		return err
+	}
+	l.head = AuditHead{Entries: e.Seq, Hash: sum}
+	return nil
+}
+
+// Head returns the last entry written.
+func (l *AuditLog) Head() AuditHead {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return AuditHead{Entries: l.head.Entries, Hash: append([]byte(nil), l.head.Hash...)}
+}
+
+// Err returns the first write error encountered by Hook or WithAuditLog.
+func (l *AuditLog) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// VerifyAuditLog checks the hash chain of a log written by AuditLog with the
+// same key and returns its head. Deleting entries from the end of the log is
+// only detectable by comparing the head with an anchored copy.
+func VerifyAuditLog(r io.Reader, key []byte) (AuditHead, error) {
+	head := AuditHead{Hash: make([]byte, sha256.Size)}
+
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return head, fmt.Errorf("%w: line %d: %v", ErrAuditLogTampered, line, err)
+		}
+		if e.Seq != head.Entries+1 {
+			return head, fmt.Errorf("%w: line %d: sequence %d follows %d", ErrAuditLogTampered, line, e.Seq, head.Entries)
+		}
+		if e.Prev != hex.EncodeToString(head.Hash) {
+			return head, fmt.Errorf("%w: line %d: entry %d does not chain to its predecessor", ErrAuditLogTampered, line, e.Seq)
+		}
+		sum := auditHash(key, head.Hash, &e)
+		got, err := hex.DecodeString(e.Hash)
+		if err != nil || !hmac.Equal(got, sum) {
+			return head, fmt.Errorf("%w: line %d: entry %d hash mismatch", ErrAuditLogTampered, line, e.Seq)
+		}
+		head = AuditHead{Entries: e.Seq, Hash: sum}
+	}
+	return head, sc.Err()
+}
+
+func auditHash(key, prev []byte, e *auditEntry) []byte {
+	var h hash.Hash
+	if key != nil {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(prev)
+
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], e.Seq)
+	binary.BigEndian.PutUint64(buf[8:], uint64(e.Time.UnixNano()))
+	h.Write(buf[:])
+	writeLengthPrefixed(h, []byte(e.Op))
+	writeLengthPrefixed(h, []byte(e.KeyID))
+	writeLengthPrefixed(h, []byte(e.Outcome))
+	writeLengthPrefixed(h, []byte(e.ContextDigest))
+	return h.Sum(nil)
+}
@@ -0,0 +1,75 @@
+package ppassrc
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"time"
+)
+
+// CalendarPeriod is a calendar-aligned redemption period.
+type CalendarPeriod uint8
+
+const (
+	PeriodDay CalendarPeriod = iota + 1
+	PeriodISOWeek
+	PeriodMonth
+	PeriodQuarter
+)
+
+func (p CalendarPeriod) String() string {
+	switch p {
+	case PeriodDay:
+		return "day"
+	case PeriodISOWeek:
+		return "isoweek"
+	case PeriodMonth:
+		return "month"
+	case PeriodQuarter:
+		return "quarter"
+	default:
+		return fmt.Sprintf("CalendarPeriod(%d)", uint8(p))
+	}
+}
+
+// CalendarPeriodID returns the canonical name of the period containing t as
+// seen in loc: "2025-11-17" for days, "2025-W47" for ISO weeks, "2025-11" for
+// months and "2025-Q4" for quarters. A nil loc means UTC.
+func CalendarPeriodID(t time.Time, p CalendarPeriod, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+
+	switch p {
+	case PeriodDay:
+		return fmt.Sprintf("%04d-%02d-%02d", t.Year(), int(t.Month()), t.Day())
+	case PeriodISOWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case PeriodMonth:
+		return fmt.Sprintf("%04d-%02d", t.Year(), int(t.Month()))
+	case PeriodQuarter:
+		return fmt.Sprintf("%04d-Q%d", t.Year(), (int(t.Month())+2)/3)
+	default:
+		panic("ppassrc: unknown calendar period")
+	}
+}
+
+// NewContextCalendar builds a redemption context for the calendar period
+// containing t in loc. The period kind, its canonical ID and the location
+// name are hashed length-prefixed under a domain separation tag, so the same
+// month in two time zones yields different contexts. loc should be a named
+// IANA zone (e.g. "Europe/Berlin"); a nil loc means UTC.
+func NewContextCalendar(t time.Time, p CalendarPeriod, loc *time.Location) Context {
+	if loc == nil {
+		loc = time.UTC
+	}
+	id := CalendarPeriodID(t, p, loc)
+
+	h := sha512.New()
+	h.Write([]byte("ppassrc:calendar"))
+	writeLengthPrefixed(h, []byte(p.String()))
+	writeLengthPrefixed(h, []byte(id))
+	writeLengthPrefixed(h, []byte(loc.String()))
+	return Context(h.Sum(nil))
+}
@@ -1,55 +1,158 @@
 package ppassrc
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
 
 	"github.com/bytemare/voprf"
 )
 
+// ErrStateMismatch is returned by Finalize for request state made for another
+// issuer key or Hctx version than the client's.
+var ErrStateMismatch = errors.New("ppassrc: request state does not match client")
+
+// Client requests and finalizes tokens for one issuer key. It is safe for
+// concurrent use: the state of each request lives in its RequestAux, so any
+// number of requests may be outstanding and finalized in any order.
 type Client struct {
-	cs   voprf.Identifier
-	impl *voprf.Client
+	cs    voprf.Identifier
+	pk    []byte
+	keyID []byte
+	hctx  HctxVersion
+
+	// blinders holds VOPRF clients for Request. A voprf.Client keeps the
+	// blinds of its last call, so each one is used by one request at a time.
+	blinders sync.Pool
+}
+
+// ClientOption configures optional Client behaviour.
+type ClientOption func(*Client)
+
+// WithClientHctxVersion selects the Hctx encoding; it must match the issuer's.
+// The default is HctxV1. NewClient fails for unknown versions.
+func WithClientHctxVersion(v HctxVersion) ClientOption {
+	return func(c *Client) { c.hctx = v }
 }
 
 // NewClient takes the issuer's public key (as bytes) and instantiates a VOPRF client.
-func NewClient(pubKey []byte) (*Client, error) {
+func NewClient(pubKey []byte, opts ...ClientOption) (*Client, error) {
 	cs := voprf.Ristretto255Sha512
 	cli, err := cs.Client(voprf.VOPRF, pubKey)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
-		cs:   cs,
-		impl: cli,
-	}, nil
+	c := &Client{
+		cs:    cs,
+		pk:    pubKey,
+		keyID: KeyID(pubKey),
+		hctx:  HctxV1,
+	}
+	c.blinders.New = func() any {
+		// pubKey was accepted above, so this cannot fail.
+		cli, _ := cs.Client(voprf.VOPRF, pubKey)
+		return cli
+	}
+	c.blinders.Put(cli)
+	for _, opt := range opts {
+		opt(c)
+	}
+	if err := c.hctx.check(); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 // Request implements the PPass-RC Request algorithm:
 // - sample nonce
-// - compute msg = Hctx(ctx, nonce)
+// - compute msg = Hctx(ctx, nonce) under the configured version
 // - blind msg with VOPRF client
-func (c *Client) Request(ctx Context) (BlindedToken, RequestAux, error) {
+func (c *Client) Request(rctx Context) (BlindedToken, RequestAux, error) {
+	return c.RequestContext(context.Background(), rctx)
+}
+
+// RequestContext is like Request but returns ctx's error without doing any
+// work if ctx is already done. Request itself never blocks.
+func (c *Client) RequestContext(ctx context.Context, rctx Context) (BlindedToken, RequestAux, error) {
+	if err := ctx.Err(); err != nil {
+		return BlindedToken{}, RequestAux{}, err
+	}
+
 	nonce := make([]byte, 32)
 	_, _ = rand.Read(nonce)
 
-	msg := Hctx(ctx, nonce)
+	msg := c.hctx.Hash(rctx, nonce)
 
-	blinded := c.impl.Blind(msg, nil) // VOPRF handles blind scalar internally
+	// Drop the previous blind so the VOPRF client samples a fresh one; it
+	// would otherwise reuse the first blind for every request.
+	cli := c.blinders.Get().(*voprf.Client)
+	cli.SetBlinds(nil)
+	blinds, blinded, err := cli.BlindBatch([][]byte{msg}, nil)
+	c.blinders.Put(cli)
+	if err != nil {
+		return BlindedToken{}, RequestAux{}, err
+	}
 
 	aux := RequestAux{
-		Nonce: nonce,
+		Nonce:   nonce,
+		Context: rctx,
+		Blind:   blinds[0],
+		Blinded: blinded[0],
+		KeyID:   c.keyID,
+		Hctx:    c.hctx,
 	}
-	return BlindedToken{Blinded: blinded}, aux, nil
+	return BlindedToken{Blinded: blinded[0]}, aux, nil
 }
 
 // Finalize unblinds the issuer's evaluation and returns the usable token.
+// The blinding state is taken from aux, so aux may come from an earlier
+// process as long as the client uses the same issuer key and Hctx version;
+// otherwise Finalize fails with ErrStateMismatch.
 func (c *Client) Finalize(eval *Evaluation, aux RequestAux) (*Token, error) {
+	return c.FinalizeContext(context.Background(), eval, aux)
+}
+
+// FinalizeContext is like Finalize but returns ctx's error without doing any
+// work if ctx is already done. Finalize itself never blocks.
+func (c *Client) FinalizeContext(ctx context.Context, eval *Evaluation, aux RequestAux) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(aux.Blind) == 0 || len(aux.Blinded) == 0 {
+		return nil, errors.New("ppassrc: request state carries no blind")
+	}
+	if len(aux.KeyID) == 0 || aux.Hctx == 0 {
+		return nil, fmt.Errorf("%w: request state records no issuer key or Hctx version", ErrStateMismatch)
+	}
+	if !bytes.Equal(aux.KeyID, c.keyID) {
+		return nil, fmt.Errorf("%w: made for issuer key %x, client has %x", ErrStateMismatch, aux.KeyID, c.keyID)
+	}
+	if aux.Hctx != c.hctx {
+		return nil, fmt.Errorf("%w: made under Hctx version %d, client uses %d", ErrStateMismatch, aux.Hctx, c.hctx)
+	}
+
 	ev := new(voprf.Evaluation)
 	if err := ev.Deserialize(eval.Eval); err != nil {
 		return nil, err
 	}
 
-	out, err := c.impl.Finalize(ev, nil)
+	st := &voprf.State{
+		Identifier:      c.cs,
+		ServerPublicKey: c.pk,
+		Input:           [][]byte{c.hctx.Hash(aux.Context, aux.Nonce)},
+		Blind:           [][]byte{aux.Blind},
+		Blinded:         [][]byte{aux.Blinded},
+		Mode:            voprf.VOPRF,
+	}
+	cli, err := st.RecoverClient()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := cli.Finalize(ev, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -58,4 +161,4 @@ func (c *Client) Finalize(eval *Evaluation, aux RequestAux) (*Token, error) {
 		Value: out,
 		Nonce: aux.Nonce,
 	}, nil
-}
\ No newline at end of file
+}
@@ -3,10 +3,30 @@ package ppassrc
 import (
 	"crypto/sha512"
 	"encoding/binary"
+	"fmt"
+	"hash"
+	"sort"
 	"time"
 )
 
-// Hctx hashes (ctx || nonce) into a PRF input.
+// HctxVersion selects how a (ctx, nonce) pair is encoded into the PRF input.
+// Client and issuer must agree on the version.
+type HctxVersion uint8
+
+const (
+	// HctxV1 is the original encoding, SHA-512(ctx || nonce). Since neither
+	// input is length-prefixed, distinct pairs collide whenever their
+	// concatenations agree (e.g. ("ab", "c") and ("a", "bc")).
+	HctxV1 HctxVersion = 1
+	// HctxV2 hashes a domain separation tag followed by length-prefixed ctx
+	// and nonce.
+	HctxV2 HctxVersion = 2
+)
+
+const hctxV2Tag = "ppassrc:hctx:v2"
+
+// Hctx hashes (ctx || nonce) into a PRF input. It is the HctxV1 encoding,
+// kept for compatibility.
 func Hctx(ctx Context, nonce []byte) []byte {
 	h := sha512.New()
 	h.Write(ctx)
@@ -14,6 +34,39 @@ func Hctx(ctx Context, nonce []byte) []byte {
 	return h.Sum(nil)
 }
 
+// Hash computes the PRF input for (ctx, nonce) under version v. It panics
+// for versions other than HctxV1 and HctxV2 rather than guess an encoding;
+// NewClient, NewIssuer and the decoders reject them before they get here.
+func (v HctxVersion) Hash(ctx Context, nonce []byte) []byte {
+	switch v {
+	case HctxV1:
+		return Hctx(ctx, nonce)
+	case HctxV2:
+	default:
+		panic(fmt.Sprintf("ppassrc: unknown Hctx version %d", v))
+	}
+	h := sha512.New()
+	h.Write([]byte(hctxV2Tag))
+	writeLengthPrefixed(h, ctx)
+	writeLengthPrefixed(h, nonce)
+	return h.Sum(nil)
+}
+
+// check reports an error for versions other than HctxV1 and HctxV2.
+func (v HctxVersion) check() error {
+	if v != HctxV1 && v != HctxV2 {
+		return fmt.Errorf("ppassrc: unknown Hctx version %d", v)
+	}
+	return nil
+}
+
+func writeLengthPrefixed(h hash.Hash, b []byte) {
+	var l [8]byte
+	binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+	h.Write(l[:])
+	h.Write(b)
+}
+
 // NewContextTimeWindow builds a redemption context derived from the time window
 // containing the provided timestamp.
 func NewContextTimeWindow(now time.Time, window time.Duration) Context {
@@ -31,3 +84,73 @@ func NewContextTimeWindow(now time.Time, window time.Duration) Context {
 	h.Write(data)
 	return Context(h.Sum(nil))
 }
+
+const contextBuilderTag = "ppassrc:ctx:v1"
+
+// Field tags of the structured context encoding.
+const (
+	fieldOrigin byte = 1
+	fieldEpoch  byte = 2
+	fieldAction byte = 3
+	fieldScope  byte = 4
+)
+
+// ContextBuilder assembles a Context from typed fields. The encoding is a
+// domain separation tag followed by the set fields in tag order, each as
+// tag || uint64 length || value, so distinct field sets never encode to the
+// same bytes and the order of the builder calls does not matter.
+type ContextBuilder struct {
+	fields map[byte][]byte
+}
+
+// NewContextBuilder returns an empty builder.
+func NewContextBuilder() *ContextBuilder {
+	return &ContextBuilder{fields: make(map[byte][]byte)}
+}
+
+// Origin sets the origin (e.g. "https://example.com") the token is bound to.
+func (b *ContextBuilder) Origin(origin string) *ContextBuilder {
+	b.fields[fieldOrigin] = []byte(origin)
+	return b
+}
+
+// Epoch sets the epoch number the token is valid in.
+func (b *ContextBuilder) Epoch(epoch uint64) *ContextBuilder {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, epoch)
+	b.fields[fieldEpoch] = v
+	return b
+}
+
+// Action sets the action (e.g. "login", "comment") the token authorizes.
+func (b *ContextBuilder) Action(action string) *ContextBuilder {
+	b.fields[fieldAction] = []byte(action)
+	return b
+}
+
+// Scope sets a free-form deployment-specific scope.
+func (b *ContextBuilder) Scope(scope string) *ContextBuilder {
+	b.fields[fieldScope] = []byte(scope)
+	return b
+}
+
+// Build serializes the fields set so far into a Context.
+func (b *ContextBuilder) Build() Context {
+	tags := make([]int, 0, len(b.fields))
+	size := len(contextBuilderTag)
+	for tag, v := range b.fields {
+		tags = append(tags, int(tag))
+		size += 1 + 8 + len(v)
+	}
+	sort.Ints(tags)
+
+	out := make([]byte, 0, size)
+	out = append(out, contextBuilderTag...)
+	for _, tag := range tags {
+		v := b.fields[byte(tag)]
+		out = append(out, byte(tag))
+		out = binary.BigEndian.AppendUint64(out, uint64(len(v)))
+		out = append(out, v...)
+	}
+	return Context(out)
+}
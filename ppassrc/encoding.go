@@ -0,0 +1,209 @@
+package ppassrc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrMalformed is wrapped by every error returned when decoding a message.
+var ErrMalformed = errors.New("ppassrc: malformed message")
+
+// Every encoded message starts with a type tag and an encoding version,
+// followed by its fields, each prefixed with a 4-byte big-endian length.
+type msgType byte
+
+const (
+	msgBlindedToken msgType = 1
+	msgEvaluation   msgType = 2
+	msgToken        msgType = 3
+	msgRequestAux   msgType = 4
+	msgIssuerKey    msgType = 5
+	msgPublicKey    msgType = 6
+)
+
+const encodingVersion = 1
+
+// requestAuxVersion is the RequestAux encoding, which also records the
+// issuer key ID and Hctx version. The version 1 encoding, without them, is
+// not accepted.
+const requestAuxVersion = 2
+
+func (t msgType) String() string {
+	switch t {
+	case msgBlindedToken:
+		return "blinded token"
+	case msgEvaluation:
+		return "evaluation"
+	case msgToken:
+		return "token"
+	case msgRequestAux:
+		return "request state"
+	case msgIssuerKey:
+		return "issuer key"
+	case msgPublicKey:
+		return "public key"
+	default:
+		return fmt.Sprintf("unknown message type %d", byte(t))
+	}
+}
+
+func encodeMessage(t msgType, fields ...[]byte) []byte {
+	return encodeMessageVersion(t, encodingVersion, fields...)
+}
+
+func encodeMessageVersion(t msgType, version byte, fields ...[]byte) []byte {
+	size := 2
+	for _, f := range fields {
+		size += 4 + len(f)
+	}
+	out := make([]byte, 0, size)
+	out = append(out, byte(t), version)
+	for _, f := range fields {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(f)))
+		out = append(out, f...)
+	}
+	return out
+}
+
+// decodeMessage checks the header of data and splits it into exactly n fields.
+func decodeMessage(t msgType, data []byte, n int) ([][]byte, error) {
+	f, _, err := decodeMessageVersion(t, data, map[byte]int{encodingVersion: n})
+	return f, err
+}
+
+// decodeMessageVersion is like decodeMessage for message types with several
+// encoding versions; counts maps each supported version to its field count.
+func decodeMessageVersion(t msgType, data []byte, counts map[byte]int) ([][]byte, byte, error) {
+	if len(data) < 2 {
+		return nil, 0, fmt.Errorf("%w: %d bytes is too short for a message header", ErrMalformed, len(data))
+	}
+	if got := msgType(data[0]); got != t {
+		return nil, 0, fmt.Errorf("%w: expected %s, got %s", ErrMalformed, t, got)
+	}
+	version := data[1]
+	n, ok := counts[version]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: unsupported %s encoding version %d", ErrMalformed, t, version)
+	}
+
+	rest := data[2:]
+	fields := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		if len(rest) < 4 {
+			return nil, 0, fmt.Errorf("%w: %s truncated before field %d", ErrMalformed, t, i)
+		}
+		l := binary.BigEndian.Uint32(rest)
+		rest = rest[4:]
+		if uint64(l) > uint64(len(rest)) {
+			return nil, 0, fmt.Errorf("%w: %s field %d claims %d bytes, %d left", ErrMalformed, t, i, l, len(rest))
+		}
+		fields = append(fields, rest[:l:l])
+		rest = rest[l:]
+	}
+	if len(rest) != 0 {
+		return nil, 0, fmt.Errorf("%w: %d trailing bytes after %s", ErrMalformed, len(rest), t)
+	}
+	return fields, version, nil
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (b BlindedToken) MarshalBinary() ([]byte, error) {
+	return encodeMessage(msgBlindedToken, b.Blinded), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (b *BlindedToken) UnmarshalBinary(data []byte) error {
+	f, err := decodeMessage(msgBlindedToken, data, 1)
+	if err != nil {
+		return err
+	}
+	b.Blinded = cloneBytes(f[0])
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e Evaluation) MarshalBinary() ([]byte, error) {
+	return encodeMessage(msgEvaluation, e.Eval), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (e *Evaluation) UnmarshalBinary(data []byte) error {
+	f, err := decodeMessage(msgEvaluation, data, 1)
+	if err != nil {
+		return err
+	}
+	e.Eval = cloneBytes(f[0])
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (t Token) MarshalBinary() ([]byte, error) {
+	return encodeMessage(msgToken, t.Value, t.Nonce), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (t *Token) UnmarshalBinary(data []byte) error {
+	f, err := decodeMessage(msgToken, data, 2)
+	if err != nil {
+		return err
+	}
+	t.Value = cloneBytes(f[0])
+	t.Nonce = cloneBytes(f[1])
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The encoding contains
+// the blind and must be kept as secret as the token it will produce. The
+// state must record a 32-byte key ID and HctxV1 or HctxV2.
+func (a RequestAux) MarshalBinary() ([]byte, error) {
+	if len(a.KeyID) != sha256.Size {
+		return nil, fmt.Errorf("ppassrc: %s key ID is %d bytes, want %d", msgRequestAux, len(a.KeyID), sha256.Size)
+	}
+	if a.Hctx.check() != nil {
+		return nil, fmt.Errorf("ppassrc: %s has no valid Hctx version", msgRequestAux)
+	}
+	return encodeMessageVersion(msgRequestAux, requestAuxVersion,
+		a.Nonce, a.Context, a.Blind, a.Blinded, a.KeyID, []byte{byte(a.Hctx)}), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (a *RequestAux) UnmarshalBinary(data []byte) error {
+	f, err := decodeRequestAux(data)
+	if err != nil {
+		return err
+	}
+	*a = RequestAux{
+		Nonce:   cloneBytes(f[0]),
+		Context: Context(cloneBytes(f[1])),
+		Blind:   cloneBytes(f[2]),
+		Blinded: cloneBytes(f[3]),
+		KeyID:   cloneBytes(f[4]),
+		Hctx:    HctxVersion(f[5][0]),
+	}
+	return nil
+}
+
+// decodeRequestAux splits an encoded RequestAux into its six fields and
+// checks the key ID and Hctx version.
+func decodeRequestAux(data []byte) ([][]byte, error) {
+	f, _, err := decodeMessageVersion(msgRequestAux, data, map[byte]int{requestAuxVersion: 6})
+	if err != nil {
+		return nil, err
+	}
+	if len(f[4]) != sha256.Size {
+		return nil, fmt.Errorf("%w: %s key ID is %d bytes, want %d", ErrMalformed, msgRequestAux, len(f[4]), sha256.Size)
+	}
+	if len(f[5]) != 1 || HctxVersion(f[5][0]).check() != nil {
+		return nil, fmt.Errorf("%w: %s has no valid Hctx version", ErrMalformed, msgRequestAux)
+	}
+	return f, nil
+}
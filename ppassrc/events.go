@@ -0,0 +1,99 @@
+package ppassrc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Event records one issuance or redemption decision. It never carries token
+// values, blinded elements or nonces.
+type Event struct {
+	Time          time.Time
+	Op            string // "issue" or "redeem"
+	KeyID         string // hex encoded KeyID of the issuer's public key
+	Outcome       Outcome
+	ContextDigest string // hex SHA-256 of the redemption context; empty for issuance
+}
+
+// EventHook is called synchronously after every issuance and redemption. It
+// must be safe for concurrent use and should return quickly.
+type EventHook func(Event)
+
+// WithEventHook adds h to the hooks called for every issuer or verifier
+// decision.
+func WithEventHook(h EventHook) IssuerOption {
+	return func(iss *Issuer) { iss.hooks = append(iss.hooks, h) }
+}
+
+// ContextDigest returns the hex SHA-256 digest of ctx, as used in events.
+func ContextDigest(ctx Context) string {
+	d := sha256.Sum256(ctx)
+	return hex.EncodeToString(d[:])
+}
+
+// observeIssue reports an issuance that ended with err and returns err, or
+// the audit log's error if the issuance succeeded but could not be recorded.
+func (iss *Issuer) observeIssue(start time.Time, err error) error {
+	if iss.metrics == nil && len(iss.hooks) == 0 && len(iss.audits) == 0 {
+		return err
+	}
+	outcome := OutcomeIssued
+	switch {
+	case errors.Is(err, ErrAttestationFailed):
+		outcome = OutcomeAttestationFailed
+	case err != nil:
+		outcome = OutcomeError
+	}
+
+	ev := Event{Time: start, Op: "issue", KeyID: iss.keyLabel, Outcome: outcome}
+	if auditErr := iss.audit(ev); auditErr != nil && err == nil {
+		err, ev.Outcome = auditErr, OutcomeError
+	}
+	if iss.metrics != nil {
+		iss.metrics.ObserveIssue(iss.keyLabel, ev.Outcome, time.Since(start))
+	}
+	iss.emit(ev)
+	return err
+}
+
+// observeRedeem reports a redemption like observeIssue. An accepted token
+// that could not be recorded is reported as OutcomeError; it stays spent.
+func (v *Verifier) observeRedeem(start time.Time, ctx Context, outcome Outcome, err error) (Outcome, error) {
+	if len(v.audits) > 0 {
+		ev := Event{Time: start, Op: "redeem", KeyID: v.keyLabel, Outcome: outcome, ContextDigest: ContextDigest(ctx)}
+		if auditErr := v.audit(ev); auditErr != nil && err == nil {
+			outcome, err = OutcomeError, auditErr
+		}
+	}
+	if v.metrics != nil {
+		v.metrics.ObserveRedeem(v.keyLabel, outcome, time.Since(start))
+		if l, ok := v.spent.(interface{ Len() int }); ok && outcome == OutcomeAccepted {
+			v.metrics.SetSpentSetSize(v.keyLabel, l.Len())
+		}
+	}
+	if len(v.hooks) > 0 {
+		v.emit(Event{Time: start, Op: "redeem", KeyID: v.keyLabel, Outcome: outcome, ContextDigest: ContextDigest(ctx)})
+	}
+	return outcome, err
+}
+
+func (v *Verifier) emit(ev Event) {
+	for _, h := range v.hooks {
+		h(ev)
+	}
+}
+
+// audit records ev in every audit log added with WithAuditLog and returns the
+// first error.
+func (v *Verifier) audit(ev Event) error {
+	var first error
+	for _, l := range v.audits {
+		if err := l.Record(ev); err != nil && first == nil {
+			first = fmt.Errorf("ppassrc: audit log: %w", err)
+		}
+	}
+	return first
+}
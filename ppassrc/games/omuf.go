@@ -0,0 +1,127 @@
+// Package games models the security experiments of the PPass-RC paper as
+// executable games. A game plays the challenger against a pluggable
+// adversary and reports whether the adversary won, so attack strategies can
+// be kept as regression tests against the implementation.
+package games
+
+import (
+	"errors"
+	"sync"
+
+	"ppassrc/ppassrc"
+)
+
+// ErrQueryBudget is returned by the issuance oracle once the adversary has
+// used up its queries.
+var ErrQueryBudget = errors.New("games: issuance query budget exhausted")
+
+// Forgery is a token the adversary claims is valid for Context.
+type Forgery struct {
+	Context ppassrc.Context
+	Token   *ppassrc.Token
+}
+
+// OMUFAdversary plays the one-more-unforgeability game: given an issuance
+// oracle it outputs tokens, hoping more of them redeem than it was issued.
+type OMUFAdversary interface {
+	Forge(oracle *IssuanceOracle) ([]Forgery, error)
+}
+
+// OMUFAdversaryFunc adapts a function to OMUFAdversary.
+type OMUFAdversaryFunc func(oracle *IssuanceOracle) ([]Forgery, error)
+
+// Forge implements OMUFAdversary.
+func (f OMUFAdversaryFunc) Forge(oracle *IssuanceOracle) ([]Forgery, error) { return f(oracle) }
+
+// IssuanceOracle answers the adversary's blinded issuance requests with an
+// honest issuer and counts the evaluations it hands out.
+type IssuanceOracle struct {
+	iss    *ppassrc.Issuer
+	hctx   ppassrc.HctxVersion
+	budget int
+
+	mu      sync.Mutex
+	queries int
+}
+
+// PublicKey returns the challenger issuer's public key.
+func (o *IssuanceOracle) PublicKey() []byte { return o.iss.VerificationKey() }
+
+// HctxVersion returns the Hctx encoding the issuer redeems under.
+func (o *IssuanceOracle) HctxVersion() ppassrc.HctxVersion { return o.hctx }
+
+// Issue evaluates b. Only successful evaluations count as queries.
+func (o *IssuanceOracle) Issue(b ppassrc.BlindedToken) (*ppassrc.Evaluation, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.budget > 0 && o.queries >= o.budget {
+		return nil, ErrQueryBudget
+	}
+	eval, err := o.iss.Issue(b)
+	if err != nil {
+		return nil, err
+	}
+	o.queries++
+	return eval, nil
+}
+
+// Queries returns the number of evaluations issued so far.
+func (o *IssuanceOracle) Queries() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.queries
+}
+
+// OMUFGame is the one-more-unforgeability experiment: the challenger runs a
+// fresh issuer, gives the adversary its public key and an issuance oracle,
+// and redeems every forgery the adversary returns. The adversary wins if more
+// forgeries are accepted than the oracle issued.
+type OMUFGame struct {
+	// MaxQueries bounds the issuance oracle; zero means unbounded.
+	MaxQueries int
+	// Hctx is the Hctx encoding the issuer uses.
+	Hctx ppassrc.HctxVersion
+	// IssuerOptions configure the challenger's issuer, e.g. its spent store.
+	IssuerOptions []ppassrc.IssuerOption
+}
+
+// OMUFResult reports one play of OMUFGame.
+type OMUFResult struct {
+	Queries   int // evaluations issued by the oracle
+	Forgeries int // tokens output by the adversary
+	Accepted  int // forgeries the issuer redeemed
+	Won       bool
+}
+
+// Play runs the game once against adv. An error means the game could not be
+// set up or the adversary gave up; it is not a loss for either side.
+func (g OMUFGame) Play(adv OMUFAdversary) (*OMUFResult, error) {
+	hctx := g.Hctx
+	if hctx == 0 {
+		hctx = ppassrc.HctxV1
+	}
+	opts := append([]ppassrc.IssuerOption{ppassrc.WithHctxVersion(hctx)}, g.IssuerOptions...)
+	iss, err := ppassrc.NewIssuer(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	oracle := &IssuanceOracle{iss: iss, hctx: hctx, budget: g.MaxQueries}
+	forgeries, err := adv.Forge(oracle)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &OMUFResult{Queries: oracle.Queries(), Forgeries: len(forgeries)}
+	for _, f := range forgeries {
+		if f.Token == nil {
+			continue
+		}
+		if ok, _ := iss.Redeem(f.Context, f.Token); ok {
+			res.Accepted++
+		}
+	}
+	res.Won = res.Accepted > res.Queries
+	return res, nil
+}
@@ -0,0 +1,118 @@
+package games
+
+import (
+	"crypto/rand"
+	"math"
+
+	"ppassrc/ppassrc"
+)
+
+// UnlinkabilityAdversary plays the unlinkability game as a malicious issuer.
+// It chooses the public key and context, answers both users' issuance
+// requests however it likes, and then guesses which user's token is
+// redeemed first.
+type UnlinkabilityAdversary interface {
+	// Setup returns the issuer public key both users fetch and the context
+	// they request tokens for.
+	Setup() (pk []byte, rctx ppassrc.Context, err error)
+	// Issue answers the issuance request of user 0 or 1.
+	Issue(user int, b ppassrc.BlindedToken) (*ppassrc.Evaluation, error)
+	// Guess sees the two tokens in redemption order and returns which user
+	// (0 or 1) redeemed first. Both tokens are nil if either user failed to
+	// obtain one, so failures cannot single out a user.
+	Guess(first, second *ppassrc.Token) int
+}
+
+// UnlinkabilityGame is the unlinkability experiment with a malicious-issuer
+// challenger: two honest users obtain a token each from the adversary for the
+// same context, and the challenger redeems them in an order given by a
+// secret coin. The implementation is unlinkable if no adversary guesses the
+// coin noticeably better than chance.
+type UnlinkabilityGame struct {
+	// Rounds is the number of independent plays; it defaults to 100.
+	Rounds int
+	// Hctx is the Hctx encoding the honest users request under.
+	Hctx ppassrc.HctxVersion
+}
+
+// UnlinkabilityResult reports the plays of UnlinkabilityGame.
+type UnlinkabilityResult struct {
+	Rounds int
+	Wins   int
+	// Failed counts rounds in which either user did not obtain a token.
+	Failed int
+}
+
+// Advantage returns |2·Pr[win] − 1|, which is 0 for blind guessing and 1 for
+// an adversary that always links.
+func (r *UnlinkabilityResult) Advantage() float64 {
+	if r.Rounds == 0 {
+		return 0
+	}
+	return math.Abs(2*float64(r.Wins)/float64(r.Rounds) - 1)
+}
+
+// Play runs the game against adv. Setup errors abort the game; issuance
+// errors only make the round fail for both users.
+func (g UnlinkabilityGame) Play(adv UnlinkabilityAdversary) (*UnlinkabilityResult, error) {
+	rounds := g.Rounds
+	if rounds <= 0 {
+		rounds = 100
+	}
+	hctx := g.Hctx
+	if hctx == 0 {
+		hctx = ppassrc.HctxV1
+	}
+
+	res := &UnlinkabilityResult{Rounds: rounds}
+	for i := 0; i < rounds; i++ {
+		pk, rctx, err := adv.Setup()
+		if err != nil {
+			return nil, err
+		}
+		toks, ok := g.issueBoth(adv, pk, rctx, hctx)
+		if !ok {
+			res.Failed++
+			toks = [2]*ppassrc.Token{}
+		}
+
+		coin := randomBit()
+		if adv.Guess(toks[coin], toks[1-coin]) == coin {
+			res.Wins++
+		}
+	}
+	return res, nil
+}
+
+// issueBoth runs issuance for both users with their own clients.
+func (g UnlinkabilityGame) issueBoth(adv UnlinkabilityAdversary, pk []byte, rctx ppassrc.Context, hctx ppassrc.HctxVersion) ([2]*ppassrc.Token, bool) {
+	var toks [2]*ppassrc.Token
+	for user := 0; user < 2; user++ {
+		client, err := ppassrc.NewClient(pk, ppassrc.WithClientHctxVersion(hctx))
+		if err != nil {
+			return toks, false
+		}
+		b, aux, err := client.Request(rctx)
+		if err != nil {
+			return toks, false
+		}
+		eval, err := adv.Issue(user, b)
+		if err != nil || eval == nil {
+			return toks, false
+		}
+		tok, err := client.Finalize(eval, aux)
+		if err != nil {
+			return toks, false
+		}
+		toks[user] = tok
+	}
+	return toks, true
+}
+
+func randomBit() int {
+	var b [1]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("games: crypto/rand failed: " + err.Error())
+	}
+	return int(b[0] & 1)
+}
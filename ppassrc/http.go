@@ -0,0 +1,270 @@
+package ppassrc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTP paths served by NewHTTPHandler. Both take a POST with a binary
+// message body (see MarshalBinary) of type application/octet-stream.
+const (
+	IssuePath  = "/issue"  // BlindedToken in, evidence in EvidenceHeader, Evaluation out
+	RedeemPath = "/redeem" // Token in, redemption context in ContextHeader
+)
+
+// ContextHeader carries the base64 (standard, padded) redemption context of
+// a redeem request.
+const ContextHeader = "Ppassrc-Context"
+
+// EvidenceHeader carries the attestation evidence of an issue request, one
+// header line per evidence type, as the type, "=" and the base64 (standard,
+// padded) payload.
+const EvidenceHeader = "Ppassrc-Evidence"
+
+// maxHTTPBody bounds request and response bodies; every message is far
+// smaller.
+const maxHTTPBody = 64 << 10
+
+// ErrIssuanceRejected is returned by HTTPIssuer's issue methods when the issuer
+// refused to evaluate the request, e.g. because attestation failed.
+var ErrIssuanceRejected = errors.New("ppassrc: issuance rejected")
+
+// NewHTTPHandler serves iss over HTTP. Redemption answers 200 when the token
+// is accepted, 403 when it is invalid for the context and 409 when it was
+// already spent. Issuance passes the evidence in EvidenceHeader to the
+// issuer's attester and answers 403 when it is refused. Request contexts are
+// passed to IssueWithEvidenceContext and RedeemContext, so a client
+// disconnect aborts a blocked spent-store lookup.
+func NewHTTPHandler(iss *Issuer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(IssuePath, func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readHTTPBody(w, r)
+		if !ok {
+			return
+		}
+		ev, err := parseEvidence(r.Header.Values(EvidenceHeader))
+		if err != nil {
+			http.Error(w, EvidenceHeader+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var b BlindedToken
+		if err := b.UnmarshalBinary(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		eval, err := iss.IssueWithEvidenceContext(r.Context(), b, ev)
+		switch {
+		case errors.Is(err, ErrAttestationFailed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		raw, _ := eval.MarshalBinary()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(raw)
+	})
+	mux.HandleFunc(RedeemPath, redeemHandler(iss.Verifier))
+	return mux
+}
+
+// NewVerifierHandler serves redemption only, on RedeemPath with the same
+// answers as NewHTTPHandler. v is an issuer's Verifier, so the handler runs
+// where the issuer key is kept; it is the verification service
+// RemoteVerifiers on the redemption hosts ask.
+func NewVerifierHandler(v *Verifier) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(RedeemPath, redeemHandler(v))
+	return mux
+}
+
+func redeemHandler(v *Verifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readHTTPBody(w, r)
+		if !ok {
+			return
+		}
+		rctx, err := base64.StdEncoding.DecodeString(r.Header.Get(ContextHeader))
+		if err != nil {
+			http.Error(w, ContextHeader+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var tok Token
+		if err := tok.UnmarshalBinary(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		outcome, err := v.redeemOutcome(r.Context(), Context(rctx), &tok)
+		switch outcome {
+		case OutcomeAccepted:
+			io.WriteString(w, string(outcome)+"\n")
+		case OutcomeInvalid:
+			http.Error(w, string(outcome), http.StatusForbidden)
+		case OutcomeDoubleSpend:
+			http.Error(w, string(outcome), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+	}
+}
+
+// parseEvidence decodes EvidenceHeader values. Values joined by commas, as
+// proxies may do with repeated headers, are split again.
+func parseEvidence(values []string) (Evidence, error) {
+	var ev Evidence
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			kind, payload, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok || kind == "" {
+				return nil, fmt.Errorf("%q is not type=payload", item)
+			}
+			raw, err := base64.StdEncoding.DecodeString(payload)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", kind, err)
+			}
+			if ev == nil {
+				ev = make(Evidence)
+			}
+			if _, dup := ev[kind]; dup {
+				return nil, fmt.Errorf("%s given twice", kind)
+			}
+			ev[kind] = raw
+		}
+	}
+	return ev, nil
+}
+
+func readHTTPBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return body, true
+}
+
+// HTTPIssuer talks to an issuer served by NewHTTPHandler.
+type HTTPIssuer struct {
+	base string
+	hc   *http.Client
+}
+
+// NewHTTPIssuer returns a client for the issuer at baseURL. A nil hc means
+// http.DefaultClient.
+func NewHTTPIssuer(baseURL string, hc *http.Client) *HTTPIssuer {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &HTTPIssuer{base: strings.TrimSuffix(baseURL, "/"), hc: hc}
+}
+
+// IssueContext sends b for evaluation.
+func (h *HTTPIssuer) IssueContext(ctx context.Context, b BlindedToken) (*Evaluation, error) {
+	return h.IssueWithEvidenceContext(ctx, b, nil)
+}
+
+// IssueWithEvidenceContext sends b for evaluation together with ev for the
+// issuer's attester. Evidence types must not contain "," or "=" or start or
+// end with white space.
+func (h *HTTPIssuer) IssueWithEvidenceContext(ctx context.Context, b BlindedToken, ev Evidence) (*Evaluation, error) {
+	raw, _ := b.MarshalBinary()
+	var hdr http.Header
+	for kind, payload := range ev {
+		if kind == "" || strings.ContainsAny(kind, ",=") || strings.TrimSpace(kind) != kind {
+			return nil, fmt.Errorf("ppassrc: issue: invalid evidence type %q", kind)
+		}
+		if hdr == nil {
+			hdr = make(http.Header)
+		}
+		hdr[EvidenceHeader] = append(hdr[EvidenceHeader], kind+"="+base64.StdEncoding.EncodeToString(payload))
+	}
+	status, body, err := h.post(ctx, IssuePath, raw, hdr)
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return nil, fmt.Errorf("%w: %s", ErrIssuanceRejected, body)
+	default:
+		return nil, fmt.Errorf("ppassrc: issue: %d %s", status, body)
+	}
+
+	eval := new(Evaluation)
+	if err := eval.UnmarshalBinary(body); err != nil {
+		return nil, err
+	}
+	return eval, nil
+}
+
+// RedeemContext redeems tok for rctx. Like Issuer.Redeem it reports an
+// invalid or already spent token as (false, nil).
+func (h *HTTPIssuer) RedeemContext(ctx context.Context, rctx Context, tok *Token) (bool, error) {
+	outcome, err := redeemHTTP(ctx, h.hc, h.base+RedeemPath, rctx, tok)
+	return outcome == OutcomeAccepted, err
+}
+
+// redeemHTTP posts tok to a redeemHandler at url and maps its answer back to
+// the server's outcome.
+func redeemHTTP(ctx context.Context, hc *http.Client, url string, rctx Context, tok *Token) (Outcome, error) {
+	raw, _ := tok.MarshalBinary()
+	hdr := http.Header{ContextHeader: {base64.StdEncoding.EncodeToString(rctx)}}
+	status, body, err := postHTTP(ctx, hc, url, raw, hdr)
+	if err != nil {
+		return OutcomeError, err
+	}
+	switch status {
+	case http.StatusOK:
+		return OutcomeAccepted, nil
+	case http.StatusForbidden:
+		return OutcomeInvalid, nil
+	case http.StatusConflict:
+		return OutcomeDoubleSpend, nil
+	default:
+		return OutcomeError, fmt.Errorf("ppassrc: redeem: %d %s", status, body)
+	}
+}
+
+func (h *HTTPIssuer) post(ctx context.Context, path string, body []byte, hdr http.Header) (int, []byte, error) {
+	return postHTTP(ctx, h.hc, h.base+path, body, hdr)
+}
+
+// postHTTP posts body as application/octet-stream and returns the status and
+// the response body, trimmed of surrounding space unless the status is 200.
+func postHTTP(ctx context.Context, hc *http.Client, url string, body []byte, hdr http.Header) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBody))
+	if err != nil {
+		return 0, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		out = bytes.TrimSpace(out)
+	}
+	return resp.StatusCode, out, nil
+}
@@ -0,0 +1,287 @@
+package ppassrc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/bytemare/voprf"
+)
+
+// Sizes of the Ristretto255-SHA512 encodings.
+const (
+	elementSize = 32
+	scalarSize  = 32
+	outputSize  = 64
+	nonceSize   = 32
+)
+
+var msgFieldCount = map[msgType]int{
+	msgBlindedToken: 1,
+	msgEvaluation:   1,
+	msgToken:        2,
+	msgRequestAux:   6, // see decodeRequestAux
+	msgIssuerKey:    3,
+	msgPublicKey:    2,
+}
+
+// Inspection is a human-oriented description of an encoded protocol message,
+// as produced by Inspect.
+type Inspection struct {
+	Type     string
+	Fields   []InspectedField
+	Problems []string // why the message is malformed; empty if it is well-formed
+}
+
+// InspectedField describes one field of an inspected message.
+type InspectedField struct {
+	Name   string
+	Length int
+	Value  string // hex, digest or decoded form; secrets are never shown
+	Note   string
+}
+
+// Valid reports whether no problems were found.
+func (in *Inspection) Valid() bool { return len(in.Problems) == 0 }
+
+func (in *Inspection) String() string {
+	var b strings.Builder
+	status := "well-formed"
+	if !in.Valid() {
+		status = "MALFORMED"
+	}
+	fmt.Fprintf(&b, "type: %s (%s)\n", in.Type, status)
+	for _, f := range in.Fields {
+		fmt.Fprintf(&b, "  %-16s %4d bytes  %s", f.Name, f.Length, f.Value)
+		if f.Note != "" {
+			fmt.Fprintf(&b, "  [%s]", f.Note)
+		}
+		b.WriteByte('\n')
+	}
+	if len(in.Problems) > 0 {
+		b.WriteString("problems:\n")
+		for _, p := range in.Problems {
+			fmt.Fprintf(&b, "  - %s\n", p)
+		}
+	}
+	return b.String()
+}
+
+func (in *Inspection) problemf(format string, args ...any) {
+	in.Problems = append(in.Problems, fmt.Sprintf(format, args...))
+}
+
+func (in *Inspection) field(name string, data []byte, value, note string) {
+	in.Fields = append(in.Fields, InspectedField{Name: name, Length: len(data), Value: value, Note: note})
+}
+
+// Inspect decodes any message produced by the MarshalBinary methods,
+// MarshalKey or MarshalPublicKey, checks every group element and scalar it
+// contains, and explains what is wrong with it if it is malformed. Token
+// values, blinds and secret keys are summarized by digest or omitted.
+func Inspect(data []byte) *Inspection {
+	in := &Inspection{Type: "unknown"}
+	if len(data) < 2 {
+		in.problemf("%d bytes is too short for a message header (type, version)", len(data))
+		return in
+	}
+
+	t := msgType(data[0])
+	n, known := msgFieldCount[t]
+	if !known {
+		in.problemf("unknown message type %#02x; not produced by this package, or not decoded from base64", data[0])
+		return in
+	}
+	in.Type = t.String()
+
+	var f [][]byte
+	var err error
+	if t == msgRequestAux {
+		f, err = decodeRequestAux(data)
+	} else {
+		f, err = decodeMessage(t, data, n)
+	}
+	if err != nil {
+		in.problemf("%s", strings.TrimPrefix(err.Error(), ErrMalformed.Error()+": "))
+		return in
+	}
+
+	switch t {
+	case msgBlindedToken:
+		inspectElement(in, "blinded element", f[0])
+	case msgEvaluation:
+		inspectEvaluation(in, f[0])
+	case msgToken:
+		inspectOutput(in, "value", f[0])
+		inspectNonce(in, f[1])
+	case msgRequestAux:
+		inspectNonce(in, f[0])
+		inspectContext(in, f[1])
+		inspectScalar(in, "blind", f[2], true)
+		inspectElement(in, "blinded element", f[3])
+		in.field("issuer key id", f[4], hex.EncodeToString(f[4]), "")
+		in.field("hctx version", f[5], fmt.Sprintf("%d", f[5][0]), "")
+	case msgIssuerKey:
+		inspectSuite(in, f[0])
+		inspectScalar(in, "secret key", f[1], true)
+		inspectElement(in, "public key", f[2])
+		inspectKeyPair(in, f[1], f[2])
+	case msgPublicKey:
+		inspectSuite(in, f[0])
+		inspectElement(in, "public key", f[1])
+	}
+	return in
+}
+
+func inspectSuite(in *Inspection, name []byte) {
+	if _, err := suiteFromName(name); err != nil {
+		in.field("ciphersuite", name, fmt.Sprintf("%q", name), "unsupported")
+		in.problemf("unsupported ciphersuite %q, expected %q", name, voprf.Ristretto255Sha512)
+		return
+	}
+	in.field("ciphersuite", name, string(name), "")
+}
+
+func inspectElement(in *Inspection, name string, b []byte) {
+	value := hex.EncodeToString(b)
+	if name == "public key" {
+		value += " (key id " + hex.EncodeToString(KeyID(b)) + ")"
+	}
+	if len(b) != elementSize {
+		in.field(name, b, value, "wrong length")
+		in.problemf("%s is %d bytes, a ristretto255 element is %d", name, len(b), elementSize)
+		return
+	}
+	if err := voprf.Ristretto255Sha512.Group().NewElement().Decode(b); err != nil {
+		in.field(name, b, value, "invalid element")
+		in.problemf("%s is not a valid ristretto255 element: %v", name, err)
+		return
+	}
+	in.field(name, b, value, "valid element")
+}
+
+// inspectScalar checks a scalar encoding; secret scalars are not printed.
+func inspectScalar(in *Inspection, name string, b []byte, secret bool) {
+	value := hex.EncodeToString(b)
+	if secret {
+		value = "(secret, not shown)"
+	}
+	if len(b) != scalarSize {
+		in.field(name, b, value, "wrong length")
+		in.problemf("%s is %d bytes, a ristretto255 scalar is %d", name, len(b), scalarSize)
+		return
+	}
+	s := voprf.Ristretto255Sha512.Group().NewScalar()
+	if err := s.Decode(b); err != nil {
+		in.field(name, b, value, "invalid scalar")
+		in.problemf("%s is not a canonical ristretto255 scalar: %v", name, err)
+		return
+	}
+	if s.IsZero() {
+		in.field(name, b, value, "zero scalar")
+		in.problemf("%s is zero", name)
+		return
+	}
+	in.field(name, b, value, "valid scalar")
+}
+
+func inspectKeyPair(in *Inspection, sk, pk []byte) {
+	g := voprf.Ristretto255Sha512.Group()
+	s := g.NewScalar()
+	if err := s.Decode(sk); err != nil {
+		return // already reported
+	}
+	if !bytes.Equal(g.Base().Multiply(s).Encode(), pk) {
+		in.problemf("public key does not match the secret key")
+	}
+}
+
+func inspectOutput(in *Inspection, name string, b []byte) {
+	digest := sha256.Sum256(b)
+	value := "sha256 " + hex.EncodeToString(digest[:])
+	if len(b) != outputSize {
+		in.field(name, b, value, "wrong length")
+		in.problemf("%s is %d bytes, a Ristretto255-SHA512 PRF output is %d", name, len(b), outputSize)
+		return
+	}
+	in.field(name, b, value, "")
+}
+
+func inspectNonce(in *Inspection, b []byte) {
+	if len(b) != nonceSize {
+		in.field("nonce", b, hex.EncodeToString(b), "unusual length")
+		in.problemf("nonce is %d bytes, clients of this package use %d", len(b), nonceSize)
+		return
+	}
+	in.field("nonce", b, hex.EncodeToString(b), "")
+}
+
+func inspectContext(in *Inspection, ctx []byte) {
+	digest := sha256.Sum256(ctx)
+	in.field("context", ctx, "sha256 "+hex.EncodeToString(digest[:]), describeContext(ctx))
+}
+
+// describeContext renders the fields of a ContextBuilder encoding, or notes
+// that the context is opaque.
+func describeContext(ctx []byte) string {
+	if !bytes.HasPrefix(ctx, []byte(contextBuilderTag)) {
+		return "opaque"
+	}
+	rest := ctx[len(contextBuilderTag):]
+	var parts []string
+	for len(rest) > 0 {
+		if len(rest) < 9 {
+			return "structured, truncated"
+		}
+		tag, l := rest[0], binary.BigEndian.Uint64(rest[1:9])
+		rest = rest[9:]
+		if l > uint64(len(rest)) {
+			return "structured, truncated"
+		}
+		v := rest[:l]
+		rest = rest[l:]
+		switch tag {
+		case fieldOrigin:
+			parts = append(parts, fmt.Sprintf("origin=%q", v))
+		case fieldEpoch:
+			if len(v) != 8 {
+				return "structured, bad epoch"
+			}
+			parts = append(parts, fmt.Sprintf("epoch=%d", binary.BigEndian.Uint64(v)))
+		case fieldAction:
+			parts = append(parts, fmt.Sprintf("action=%q", v))
+		case fieldScope:
+			parts = append(parts, fmt.Sprintf("scope=%q", v))
+		default:
+			parts = append(parts, fmt.Sprintf("field%d=%x", tag, v))
+		}
+	}
+	return "structured: " + strings.Join(parts, " ")
+}
+
+func inspectEvaluation(in *Inspection, raw []byte) {
+	ev := new(voprf.Evaluation)
+	if err := ev.Deserialize(raw); err != nil {
+		in.field("voprf evaluation", raw, "", "undecodable")
+		in.problemf("VOPRF evaluation does not deserialize: %v", err)
+		return
+	}
+	in.field("voprf evaluation", raw, fmt.Sprintf("%d element(s)", len(ev.Elements)), "")
+
+	if len(ev.Elements) != 1 {
+		in.problemf("evaluation carries %d elements, a single-token issuance carries exactly 1", len(ev.Elements))
+	}
+	for i, el := range ev.Elements {
+		inspectElement(in, fmt.Sprintf("element[%d]", i), el)
+	}
+
+	if len(ev.ProofC) == 0 && len(ev.ProofS) == 0 {
+		in.problemf("evaluation has no DLEQ proof; VOPRF clients will reject it")
+		return
+	}
+	inspectScalar(in, "proof c", ev.ProofC, false)
+	inspectScalar(in, "proof s", ev.ProofS, false)
+}
@@ -1,76 +1,129 @@
 package ppassrc
 
 import (
-	"sync"
+	"context"
+	"time"
 
 	"github.com/bytemare/voprf"
 )
 
+// Issuer evaluates blinded tokens. It embeds the Verifier for its key, so it
+// also redeems tokens; deployments that redeem on other hosts give those a
+// RemoteVerifier, which asks the issuer, instead of the issuer key. It is
+// safe for concurrent use if its spent store, attester and hooks are.
 type Issuer struct {
-	cs    voprf.Identifier
-	srv   *voprf.Server
-	pk    []byte
-	mu    sync.Mutex
-	spent map[string]bool
+	*Verifier
+	attester Attester
+}
+
+// IssuerOption configures optional Issuer behaviour.
+type IssuerOption func(*Issuer)
+
+// WithAttester makes the issuer consult a before evaluating any blinded token.
+func WithAttester(a Attester) IssuerOption {
+	return func(iss *Issuer) { iss.attester = a }
+}
+
+// WithHctxVersion selects the Hctx encoding redemption contexts are checked
+// under; it must match the clients'. The default is HctxV1 for compatibility
+// with existing tokens; new deployments should use HctxV2. Issuers fail to
+// build for unknown versions.
+func WithHctxVersion(v HctxVersion) IssuerOption {
+	return func(iss *Issuer) { iss.hctx = v }
+}
+
+// WithSpentStore replaces the default in-memory spent set, e.g. with one that
+// persists across restarts or is shared between redemption nodes.
+func WithSpentStore(s SpentStore) IssuerOption {
+	return func(iss *Issuer) { iss.spent = s }
+}
+
+// WithInstrumentation reports issuance and redemption outcomes, latencies and
+// the spent-set size to in.
+func WithInstrumentation(in Instrumentation) IssuerOption {
+	return func(iss *Issuer) { iss.metrics = in }
 }
 
 // NewIssuer runs Kg: generate a VOPRF key pair and server instance.
-func NewIssuer() (*Issuer, error) {
+func NewIssuer(opts ...IssuerOption) (*Issuer, error) {
 	cs := voprf.Ristretto255Sha512
 
 	kp := cs.KeyGen() // returns *KeyPair with PublicKey, SecretKey
-	srv, err := cs.Server(voprf.VOPRF, kp.SecretKey)
+	return newIssuer(cs, kp.SecretKey, opts)
+}
+
+func newIssuer(cs voprf.Identifier, sk []byte, opts []IssuerOption) (*Issuer, error) {
+	v, err := newVerifier(cs, sk)
 	if err != nil {
 		return nil, err
 	}
+	iss := &Issuer{Verifier: v}
+	for _, opt := range opts {
+		opt(iss)
+	}
+	if err := iss.hctx.check(); err != nil {
+		return nil, err
+	}
+	return iss, nil
+}
 
-	return &Issuer{
-		cs:    cs,
-		srv:   srv,
-		pk:    kp.PublicKey,
-		spent: make(map[string]bool),
-	}, nil
+// Issue runs the VOPRF evaluation on the blinded input. When an attester is
+// configured the request carries no evidence and is therefore rejected.
+func (iss *Issuer) Issue(b BlindedToken) (*Evaluation, error) {
+	return iss.IssueWithEvidenceContext(context.Background(), b, nil)
 }
 
-// VerificationKey returns the issuer's encoded public key (to give to clients).
-func (iss *Issuer) VerificationKey() []byte {
-	return iss.pk
+// IssueContext is like Issue but gives up once ctx is done.
+func (iss *Issuer) IssueContext(ctx context.Context, b BlindedToken) (*Evaluation, error) {
+	return iss.IssueWithEvidenceContext(ctx, b, nil)
 }
 
-// Issue runs the VOPRF evaluation on the blinded input.
-func (iss *Issuer) Issue(b BlindedToken) (*Evaluation, error) {
-	eval, err := iss.srv.Evaluate(b.Blinded, nil)
-	if err != nil {
-		return nil, err
-	}
-	return &Evaluation{Eval: eval.Serialize()}, nil
+// IssueWithEvidence checks ev with the configured attester, if any, and then
+// runs the VOPRF evaluation on the blinded input.
+func (iss *Issuer) IssueWithEvidence(b BlindedToken, ev Evidence) (*Evaluation, error) {
+	return iss.IssueWithEvidenceContext(context.Background(), b, ev)
 }
 
-// Redeem verifies the PRF output and enforces one-time-use (double-spend prevention).
-func (iss *Issuer) Redeem(ctx Context, tok *Token) (bool, error) {
-	msg := Hctx(ctx, tok.Nonce)
+// IssueWithEvidenceContext is like IssueWithEvidence but gives up once ctx
+// is done. The attester gets ctx if it implements AttesterContext and is
+// skipped if ctx is already done; the evaluation itself is not interruptible.
+func (iss *Issuer) IssueWithEvidenceContext(ctx context.Context, b BlindedToken, ev Evidence) (*Evaluation, error) {
+	return iss.issueCharged(ctx, b, ev, nil)
+}
 
-	// Check PRF validity for this msg under issuer's key.
-	if !iss.srv.VerifyFinalize(msg, nil, tok.Value) {
-		return false, nil
+// issueCharged checks ev with the attester, then calls charge, if not nil,
+// and evaluates b only once both succeed, so that requests failing
+// attestation are never charged. A request charge rejects is not reported as
+// an issuance outcome, like one rejected before it reaches the issuer.
+func (iss *Issuer) issueCharged(ctx context.Context, b BlindedToken, ev Evidence, charge func(context.Context) error) (*Evaluation, error) {
+	start := time.Now()
+	if iss.attester != nil {
+		if err := attestContext(ctx, iss.attester, ev); err != nil {
+			return nil, iss.observeIssue(start, err)
+		}
 	}
+	if charge != nil {
+		if err := charge(ctx); err != nil {
+			return nil, err
+		}
+	}
+	eval, err := iss.evaluate(ctx, b)
+	if err := iss.observeIssue(start, err); err != nil {
+		return nil, err
+	}
+	return eval, nil
+}
 
-	key := string(tok.Value)
-
-	iss.mu.Lock()
-	defer iss.mu.Unlock()
-
-	if iss.spent[key] {
-		return false, nil
+func (iss *Issuer) evaluate(ctx context.Context, b BlindedToken) (*Evaluation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	iss.spent[key] = true
-	return true, nil
+	srv := iss.servers.Get().(*voprf.Server)
+	eval, err := srv.Evaluate(b.Blinded, nil)
+	iss.servers.Put(srv)
+	if err != nil {
+		return nil, err
+	}
+	return &Evaluation{Eval: eval.Serialize()}, nil
 }
-
-// ResetForBench just clears spent state for a given token (used by benchmarks).
-func (iss *Issuer) ResetForBench(tok *Token) {
-	iss.mu.Lock()
-	delete(iss.spent, string(tok.Value))
-	iss.mu.Unlock()
-}
\ No newline at end of file
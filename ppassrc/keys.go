@@ -0,0 +1,74 @@
+package ppassrc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/bytemare/voprf"
+)
+
+// KeyID identifies an issuer public key: SHA-256 over its encoding, as
+// token_key_id in Privacy Pass.
+func KeyID(pk []byte) []byte {
+	id := sha256.Sum256(pk)
+	return id[:]
+}
+
+// KeyID returns the identifier of the issuer's public key.
+func (v *Verifier) KeyID() []byte {
+	return KeyID(v.pk)
+}
+
+// MarshalKey encodes the issuer's key pair. The result contains the secret
+// key and must be stored accordingly.
+func (iss *Issuer) MarshalKey() []byte {
+	return encodeMessage(msgIssuerKey, []byte(iss.cs), iss.sk, iss.pk)
+}
+
+// NewIssuerFromKey restores an issuer from a key encoded with MarshalKey.
+// The spent set is not part of the key and starts out empty unless a
+// persistent SpentStore is supplied.
+func NewIssuerFromKey(data []byte, opts ...IssuerOption) (*Issuer, error) {
+	f, err := decodeMessage(msgIssuerKey, data, 3)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := suiteFromName(f[0])
+	if err != nil {
+		return nil, err
+	}
+
+	iss, err := newIssuer(cs, f[1], opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: issuer key: %v", ErrMalformed, err)
+	}
+	if !bytes.Equal(iss.pk, f[2]) {
+		return nil, fmt.Errorf("%w: issuer key: public key does not match secret key", ErrMalformed)
+	}
+	return iss, nil
+}
+
+// MarshalPublicKey encodes a public key together with its ciphersuite.
+func MarshalPublicKey(pk []byte) []byte {
+	return encodeMessage(msgPublicKey, []byte(voprf.Ristretto255Sha512), pk)
+}
+
+// UnmarshalPublicKey decodes a public key encoded with MarshalPublicKey.
+func UnmarshalPublicKey(data []byte) ([]byte, error) {
+	f, err := decodeMessage(msgPublicKey, data, 2)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := suiteFromName(f[0]); err != nil {
+		return nil, err
+	}
+	return cloneBytes(f[1]), nil
+}
+
+func suiteFromName(name []byte) (voprf.Identifier, error) {
+	if cs := voprf.Identifier(name); cs == voprf.Ristretto255Sha512 {
+		return cs, nil
+	}
+	return "", fmt.Errorf("%w: unsupported ciphersuite %q", ErrMalformed, name)
+}
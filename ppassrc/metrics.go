@@ -0,0 +1,220 @@
+package ppassrc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcome classifies the result of an issuance or redemption.
+type Outcome string
+
+const (
+	OutcomeIssued            Outcome = "issued"
+	OutcomeAttestationFailed Outcome = "attestation_failed"
+	OutcomeAccepted          Outcome = "accepted"
+	OutcomeInvalid           Outcome = "invalid"
+	OutcomeDoubleSpend       Outcome = "double_spend"
+	OutcomeError             Outcome = "error"
+)
+
+// Instrumentation receives measurements from an Issuer or Verifier. keyID is
+// the hex encoded KeyID of the issuer's public key. Implementations must be
+// safe for concurrent use.
+type Instrumentation interface {
+	ObserveIssue(keyID string, outcome Outcome, d time.Duration)
+	ObserveRedeem(keyID string, outcome Outcome, d time.Duration)
+	SetSpentSetSize(keyID string, n int)
+}
+
+// DefaultLatencyBuckets are the histogram upper bounds, in seconds, used by
+// NewMetrics.
+var DefaultLatencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// Metrics is an in-memory Instrumentation that serves its counters,
+// histograms and gauges over HTTP in the Prometheus text exposition format:
+//
+//	ppassrc_issue_total{key_id,outcome}               counter
+//	ppassrc_issue_duration_seconds{key_id,outcome}    histogram
+//	ppassrc_redeem_total{key_id,outcome}              counter
+//	ppassrc_redeem_duration_seconds{key_id,outcome}   histogram
+//	ppassrc_spent_tokens{key_id}                      gauge
+//
+// Double-spend attempts are redemptions with outcome="double_spend".
+type Metrics struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[seriesKey]*series
+	spent  map[string]int
+}
+
+type seriesKey struct {
+	op      string // "issue" or "redeem"
+	keyID   string
+	outcome Outcome
+}
+
+type series struct {
+	count   uint64
+	sum     float64
+	buckets []uint64 // cumulative counts are computed when writing
+}
+
+// NewMetrics returns an empty Metrics using DefaultLatencyBuckets.
+func NewMetrics() *Metrics {
+	return NewMetricsWithBuckets(DefaultLatencyBuckets)
+}
+
+// NewMetricsWithBuckets returns an empty Metrics with the given latency
+// histogram upper bounds in seconds, which must be sorted ascending.
+func NewMetricsWithBuckets(buckets []float64) *Metrics {
+	return &Metrics{
+		buckets: append([]float64(nil), buckets...),
+		series:  make(map[seriesKey]*series),
+		spent:   make(map[string]int),
+	}
+}
+
+// ObserveIssue implements Instrumentation.
+func (m *Metrics) ObserveIssue(keyID string, outcome Outcome, d time.Duration) {
+	m.observe(seriesKey{op: "issue", keyID: keyID, outcome: outcome}, d)
+}
+
+// ObserveRedeem implements Instrumentation.
+func (m *Metrics) ObserveRedeem(keyID string, outcome Outcome, d time.Duration) {
+	m.observe(seriesKey{op: "redeem", keyID: keyID, outcome: outcome}, d)
+}
+
+// SetSpentSetSize implements Instrumentation.
+func (m *Metrics) SetSpentSetSize(keyID string, n int) {
+	m.mu.Lock()
+	m.spent[keyID] = n
+	m.mu.Unlock()
+}
+
+func (m *Metrics) observe(k seriesKey, d time.Duration) {
+	secs := d.Seconds()
+	i := sort.SearchFloat64s(m.buckets, secs) // first bucket with bound >= secs
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[k]
+	if !ok {
+		s = &series{buckets: make([]uint64, len(m.buckets))}
+		m.series[k] = s
+	}
+	s.count++
+	s.sum += secs
+	if i < len(s.buckets) {
+		s.buckets[i]++
+	}
+}
+
+// ServeHTTP writes the current metrics in the text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WriteText(w)
+}
+
+// WriteText writes the current metrics in the text exposition format.
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	keys := make([]seriesKey, 0, len(m.series))
+	snap := make(map[seriesKey]series, len(m.series))
+	for k, s := range m.series {
+		keys = append(keys, k)
+		snap[k] = series{count: s.count, sum: s.sum, buckets: append([]uint64(nil), s.buckets...)}
+	}
+	spent := make(map[string]int, len(m.spent))
+	for k, n := range m.spent {
+		spent[k] = n
+	}
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.op != b.op {
+			return a.op < b.op
+		}
+		if a.keyID != b.keyID {
+			return a.keyID < b.keyID
+		}
+		return a.outcome < b.outcome
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, op := range []string{"issue", "redeem"} {
+		total := "ppassrc_" + op + "_total"
+		fmt.Fprintf(bw, "# HELP %s %s requests by key ID and outcome.\n", total, opTitle(op))
+		fmt.Fprintf(bw, "# TYPE %s counter\n", total)
+		for _, k := range keys {
+			if k.op == op {
+				fmt.Fprintf(bw, "%s%s %d\n", total, labels(k, ""), snap[k].count)
+			}
+		}
+
+		hist := "ppassrc_" + op + "_duration_seconds"
+		fmt.Fprintf(bw, "# HELP %s %s latency in seconds.\n", hist, opTitle(op))
+		fmt.Fprintf(bw, "# TYPE %s histogram\n", hist)
+		for _, k := range keys {
+			if k.op != op {
+				continue
+			}
+			s := snap[k]
+			var cum uint64
+			for i, bound := range m.buckets {
+				cum += s.buckets[i]
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", hist, labels(k, formatFloat(bound)), cum)
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", hist, labels(k, "+Inf"), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", hist, labels(k, ""), formatFloat(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", hist, labels(k, ""), s.count)
+		}
+	}
+
+	ids := make([]string, 0, len(spent))
+	for id := range spent {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	fmt.Fprintf(bw, "# HELP ppassrc_spent_tokens Tokens in the spent set.\n")
+	fmt.Fprintf(bw, "# TYPE ppassrc_spent_tokens gauge\n")
+	for _, id := range ids {
+		fmt.Fprintf(bw, "ppassrc_spent_tokens{key_id=\"%s\"} %d\n", escapeLabel(id), spent[id])
+	}
+
+	return bw.Flush()
+}
+
+func opTitle(op string) string {
+	if op == "issue" {
+		return "Issuance"
+	}
+	return "Redemption"
+}
+
+func labels(k seriesKey, le string) string {
+	out := fmt.Sprintf(`{key_id="%s",outcome="%s"`, escapeLabel(k.keyID), escapeLabel(string(k.outcome)))
+	if le != "" {
+		out += `,le="` + le + `"`
+	}
+	return out + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
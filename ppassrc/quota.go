@@ -0,0 +1,220 @@
+package ppassrc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNoIdentity is returned when no identity can be extracted from a request.
+var ErrNoIdentity = errors.New("ppassrc: request carries no identity")
+
+// QuotaExceededError is returned when an identity has used up its issuance quota.
+type QuotaExceededError struct {
+	Identity   string
+	RetryAfter time.Duration // zero when the request can never be satisfied
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("ppassrc: issuance quota exceeded for %q (retry after %s)", e.Identity, e.RetryAfter)
+	}
+	return fmt.Sprintf("ppassrc: issuance quota exceeded for %q", e.Identity)
+}
+
+// IdentityFunc extracts the identity an issuance request is charged to.
+type IdentityFunc func(req *IssuanceRequest) (string, error)
+
+// IdentityFromMetadata charges requests to the value of the given metadata key.
+func IdentityFromMetadata(key string) IdentityFunc {
+	return func(req *IssuanceRequest) (string, error) {
+		id, ok := req.Metadata[key]
+		if !ok || id == "" {
+			return "", ErrNoIdentity
+		}
+		return id, nil
+	}
+}
+
+// QuotaCounter accounts for tokens issued per identity. Allow reports whether
+// n more tokens may be issued to identity and, if not, how long to wait.
+// A non-nil error means the counter itself failed.
+type QuotaCounter interface {
+	Allow(identity string, n int) (ok bool, retryAfter time.Duration, err error)
+}
+
+// QuotaCounterContext is implemented by counters backed by remote storage.
+// AllowContext must give up and return ctx's error once ctx is done.
+type QuotaCounterContext interface {
+	QuotaCounter
+	AllowContext(ctx context.Context, identity string, n int) (ok bool, retryAfter time.Duration, err error)
+}
+
+// QuotaIssuer is a policy layer in front of Issuer.Issue that charges every
+// request to an identity and rejects it once that identity's quota is spent.
+type QuotaIssuer struct {
+	iss      *Issuer
+	identify IdentityFunc
+	counter  QuotaCounter
+}
+
+// NewQuotaIssuer wraps iss with per-identity quota enforcement.
+func NewQuotaIssuer(iss *Issuer, identify IdentityFunc, counter QuotaCounter) *QuotaIssuer {
+	return &QuotaIssuer{
+		iss:      iss,
+		identify: identify,
+		counter:  counter,
+	}
+}
+
+// Issue checks the request's evidence with the issuer's attester, charges one
+// token to the request's identity and, if the quota allows it, has the issuer
+// evaluate the blinded token. Requests that fail attestation are not charged,
+// so naming an identity is not enough to spend its quota. It returns a
+// *QuotaExceededError when the identity is over quota.
+func (q *QuotaIssuer) Issue(req IssuanceRequest) (*Evaluation, error) {
+	return q.IssueContext(context.Background(), req)
+}
+
+// IssueContext is like Issue but passes ctx to the quota counter (see
+// QuotaCounterContext) and the issuer.
+func (q *QuotaIssuer) IssueContext(ctx context.Context, req IssuanceRequest) (*Evaluation, error) {
+	id, err := q.identify(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.iss.issueCharged(ctx, req.Blinded, req.Evidence, func(ctx context.Context) error {
+		ok, retry, err := q.allow(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &QuotaExceededError{Identity: id, RetryAfter: retry}
+		}
+		return nil
+	})
+}
+
+func (q *QuotaIssuer) allow(ctx context.Context, id string) (bool, time.Duration, error) {
+	if c, ok := q.counter.(QuotaCounterContext); ok {
+		return c.AllowContext(ctx, id, 1)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, 0, err
+	}
+	return q.counter.Allow(id, 1)
+}
+
+// TokenBucket is an in-memory QuotaCounter. Every identity gets a bucket
+// holding up to Burst tokens that refills at Limit tokens per Window.
+type TokenBucket struct {
+	Limit  int
+	Window time.Duration
+	Burst  int              // defaults to Limit when zero
+	Now    func() time.Time // defaults to time.Now
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	nextSweep int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a TokenBucket granting limit tokens per window with
+// bursts of up to burst tokens.
+func NewTokenBucket(limit int, window time.Duration, burst int) *TokenBucket {
+	if limit <= 0 || window <= 0 {
+		panic("ppassrc: token bucket limit and window must be positive")
+	}
+	return &TokenBucket{
+		Limit:  limit,
+		Window: window,
+		Burst:  burst,
+	}
+}
+
+// Allow implements QuotaCounter. It fails when n is not positive, which would
+// refill the bucket, and when Limit or Window is not positive, as in a zero
+// TokenBucket.
+func (tb *TokenBucket) Allow(identity string, n int) (bool, time.Duration, error) {
+	if n <= 0 {
+		return false, 0, fmt.Errorf("ppassrc: token bucket cannot charge %d tokens", n)
+	}
+	if tb.Limit <= 0 || tb.Window <= 0 {
+		return false, 0, errors.New("ppassrc: token bucket limit and window must be positive")
+	}
+
+	now := time.Now
+	if tb.Now != nil {
+		now = tb.Now
+	}
+	t := now()
+
+	capacity := float64(tb.capacity())
+	rate := float64(tb.Limit) / float64(tb.Window) // tokens per nanosecond
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if tb.buckets == nil {
+		tb.buckets = make(map[string]*bucket)
+	}
+
+	bk, exists := tb.buckets[identity]
+	if !exists {
+		tb.sweep(t, capacity, rate)
+		bk = &bucket{tokens: capacity, last: t}
+		tb.buckets[identity] = bk
+	}
+	bk.refill(t, capacity, rate)
+
+	need := float64(n)
+	if need > capacity {
+		return false, 0, nil
+	}
+	if bk.tokens < need {
+		wait := time.Duration((need - bk.tokens) / rate)
+		return false, wait, nil
+	}
+
+	bk.tokens -= need
+	return true, 0, nil
+}
+
+func (tb *TokenBucket) capacity() int {
+	if tb.Burst > 0 {
+		return tb.Burst
+	}
+	return tb.Limit
+}
+
+// sweep drops buckets that have refilled completely, since they are
+// indistinguishable from fresh ones. It runs whenever the map has doubled.
+func (tb *TokenBucket) sweep(t time.Time, capacity, rate float64) {
+	if len(tb.buckets) < tb.nextSweep {
+		return
+	}
+	for id, bk := range tb.buckets {
+		bk.refill(t, capacity, rate)
+		if bk.tokens >= capacity {
+			delete(tb.buckets, id)
+		}
+	}
+	tb.nextSweep = 2*len(tb.buckets) + 1024
+}
+
+func (bk *bucket) refill(t time.Time, capacity, rate float64) {
+	if elapsed := t.Sub(bk.last); elapsed > 0 {
+		bk.tokens += float64(elapsed) * rate
+		if bk.tokens > capacity {
+			bk.tokens = capacity
+		}
+	}
+	bk.last = t
+}
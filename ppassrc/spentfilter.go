@@ -0,0 +1,278 @@
+package ppassrc
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"math/bits"
+	"math/rand"
+	"sync"
+)
+
+// ErrFilterFull is returned by CuckooFilter.Insert when no slot could be
+// freed for the key.
+var ErrFilterFull = errors.New("ppassrc: cuckoo filter full")
+
+const (
+	cuckooSlots    = 4   // fingerprints per bucket
+	cuckooMaxKicks = 500 // relocations tried before the filter is full
+)
+
+// CuckooFilter is an approximate set of byte strings that supports deletion.
+// It stores a 16-bit fingerprint per key in buckets of four; the bucket count
+// is a power of two, so it takes 2.1 to 4.2 bytes per key of capacity.
+// Contains has no false negatives; its false-positive rate is at most
+// 2·4/2^16 ≈ 1.2·10⁻⁴ when every slot is used and proportionally lower below
+// that.
+//
+// A CuckooFilter is not safe for concurrent use.
+type CuckooFilter struct {
+	buckets [][cuckooSlots]uint16
+	mask    uint64
+	seed    maphash.Seed
+	count   int
+
+	// victim holds a fingerprint evicted by a failed Insert, so that no key
+	// inserted earlier is lost; the filter accepts no keys while it is set.
+	victim      uint16
+	victimIndex uint64
+}
+
+// NewCuckooFilter returns a filter sized for capacity keys.
+func NewCuckooFilter(capacity int) *CuckooFilter {
+	// Cuckoo filters with four slots per bucket fill to about 95%.
+	n := uint64(capacity)*100/(cuckooSlots*95) + 1
+	n = 1 << bits.Len64(n-1)
+	return &CuckooFilter{
+		buckets: make([][cuckooSlots]uint16, n),
+		mask:    n - 1,
+		seed:    maphash.MakeSeed(),
+	}
+}
+
+func (f *CuckooFilter) locate(key []byte) (uint64, uint64, uint16) {
+	h := maphash.Bytes(f.seed, key)
+	fp := uint16(h >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	i1 := h & f.mask
+	return i1, f.altIndex(i1, fp), fp
+}
+
+func (f *CuckooFilter) altIndex(i uint64, fp uint16) uint64 {
+	return (i ^ (uint64(fp) * 0x5bd1e995)) & f.mask
+}
+
+func (f *CuckooFilter) put(i uint64, fp uint16) bool {
+	for s, v := range f.buckets[i] {
+		if v == 0 {
+			f.buckets[i][s] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// Insert adds key. It fails with ErrFilterFull once the filter cannot take
+// more keys; keys inserted before are still reported by Contains.
+func (f *CuckooFilter) Insert(key []byte) error {
+	if f.victim != 0 {
+		return ErrFilterFull
+	}
+	i1, i2, fp := f.locate(key)
+	if f.put(i1, fp) || f.put(i2, fp) {
+		f.count++
+		return nil
+	}
+
+	i := i1
+	if rand.Intn(2) == 1 {
+		i = i2
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		s := rand.Intn(cuckooSlots)
+		fp, f.buckets[i][s] = f.buckets[i][s], fp
+		i = f.altIndex(i, fp)
+		if f.put(i, fp) {
+			f.count++
+			return nil
+		}
+	}
+	f.victim, f.victimIndex = fp, i
+	f.count++
+	return ErrFilterFull
+}
+
+// Contains reports whether key may have been inserted.
+func (f *CuckooFilter) Contains(key []byte) bool {
+	i1, i2, fp := f.locate(key)
+	if f.victim == fp && (f.victimIndex == i1 || f.victimIndex == i2) {
+		return true
+	}
+	for s := 0; s < cuckooSlots; s++ {
+		if f.buckets[i1][s] == fp || f.buckets[i2][s] == fp {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes one copy of key. Deleting a key that was never inserted may
+// remove another key that shares its fingerprint, so callers must only
+// delete keys they inserted.
+func (f *CuckooFilter) Delete(key []byte) bool {
+	i1, i2, fp := f.locate(key)
+	if f.victim == fp && (f.victimIndex == i1 || f.victimIndex == i2) {
+		f.victim = 0
+		f.count--
+		return true
+	}
+	for _, i := range []uint64{i1, i2} {
+		for s := 0; s < cuckooSlots; s++ {
+			if f.buckets[i][s] == fp {
+				f.buckets[i][s] = 0
+				f.count--
+				f.reinsertVictim()
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reinsertVictim moves an evicted fingerprint back into a freed slot.
+func (f *CuckooFilter) reinsertVictim() {
+	if f.victim == 0 {
+		return
+	}
+	if f.put(f.victimIndex, f.victim) || f.put(f.altIndex(f.victimIndex, f.victim), f.victim) {
+		f.victim = 0
+	}
+}
+
+// Len returns the number of keys in the filter.
+func (f *CuckooFilter) Len() int { return f.count }
+
+// SizeBytes returns the memory taken by the filter's buckets.
+func (f *CuckooFilter) SizeBytes() int { return len(f.buckets) * cuckooSlots * 2 }
+
+// SpentAdder is implemented by spent stores that can record a key known to be
+// unspent more cheaply than Spend checks and records it, such as append-only
+// or remote stores.
+type SpentAdder interface {
+	Add(key []byte) error
+}
+
+// FilteredSpentStore puts a CuckooFilter in front of an exact SpentStore.
+// Every key spent through it is in the filter, false positives included, so a key the filter does not
+// contain is unspent and only needs recording; only filter hits, which are
+// double spends or false positives, are checked by the exact store. The
+// answer is always the exact store's: false positives cost a lookup, never a
+// wrong decision.
+//
+// The filter only knows the keys spent through this store, so the exact
+// store must not be shared with other writers. If the filter fills up, every
+// key is checked by the exact store until Rebuild gives it a fresh filter.
+type FilteredSpentStore struct {
+	mu        sync.Mutex
+	filter    *CuckooFilter
+	capacity  int
+	exact     SpentStore
+	saturated bool
+}
+
+// NewFilteredSpentStore returns a store that filters lookups to exact with a
+// CuckooFilter sized for capacity tokens. exact should start out empty.
+func NewFilteredSpentStore(exact SpentStore, capacity int) *FilteredSpentStore {
+	return &FilteredSpentStore{filter: NewCuckooFilter(capacity), capacity: capacity, exact: exact}
+}
+
+// Spend implements SpentStore.
+func (s *FilteredSpentStore) Spend(key []byte) (bool, error) {
+	return s.SpendContext(context.Background(), key)
+}
+
+// SpendContext implements SpentStoreContext. The store is locked while the
+// exact store is consulted, so that concurrent spends of one key are decided
+// one after the other.
+func (s *FilteredSpentStore) SpendContext(ctx context.Context, key []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saturated || s.filter.Contains(key) {
+		unspent, err := spendContext(ctx, s.exact, key)
+		if err == nil && unspent && !s.saturated {
+			// A false positive: the hit was another key's fingerprint. Insert
+			// this key too, so that deleting either key leaves the other's.
+			s.insert(key)
+		}
+		return unspent, err
+	}
+
+	unspent, err := true, error(nil)
+	if a, ok := s.exact.(SpentAdder); ok {
+		if err = ctx.Err(); err == nil {
+			err = a.Add(key)
+		}
+	} else {
+		unspent, err = spendContext(ctx, s.exact, key)
+	}
+	if err != nil {
+		return false, err
+	}
+	s.insert(key)
+	return unspent, nil
+}
+
+func (s *FilteredSpentStore) insert(key []byte) {
+	if s.filter.Insert(key) != nil {
+		s.saturated = true
+	}
+}
+
+// Delete marks key, which must have been spent through s, as unspent again.
+// It is meant for dropping the tokens of expired redemption contexts, which
+// can no longer be redeemed anyway. If the exact store does not support
+// deletion it keeps key, and so does the filter.
+func (s *FilteredSpentStore) Delete(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.exact.(interface{ Delete(key []byte) })
+	if !ok {
+		return
+	}
+	d.Delete(key)
+	// Keys spent after saturation are not in the filter; deleting one could
+	// remove another key's fingerprint.
+	if !s.saturated {
+		s.filter.Delete(key)
+	}
+}
+
+// Rebuild replaces the filter with a fresh one, of the capacity s was created
+// with, holding live, which must be every key the exact store holds. It lets
+// a saturated store use its filter again once enough keys were deleted. If
+// live does not fit, Rebuild returns ErrFilterFull and s stays saturated.
+//
+// No key may be spent between listing live and Rebuild returning: a key the
+// new filter misses is recorded as unspent without a check.
+func (s *FilteredSpentStore) Rebuild(live [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := NewCuckooFilter(s.capacity)
+	for _, key := range live {
+		if err := f.Insert(key); err != nil {
+			return err
+		}
+	}
+	s.filter, s.saturated = f, false
+	return nil
+}
+
+// Filter returns the store's filter, e.g. to report its size.
+func (s *FilteredSpentStore) Filter() *CuckooFilter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter
+}
@@ -0,0 +1,278 @@
+package ppassrc
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRedis wraps error replies from a Redis server.
+var ErrRedis = errors.New("ppassrc: redis")
+
+const (
+	redisMaxIdle = 16      // connections kept open between spends
+	redisMaxBulk = 1 << 20 // largest bulk string reply read
+)
+
+// SpentTTL returns how long a token redeemed with RedeemTimeWindow under the
+// given window and grace must stay spent: its context is accepted for
+// 2·grace+1 windows, and one more window covers clock skew between
+// redemption nodes. Once it has passed, the token is invalid anyway.
+func SpentTTL(window time.Duration, grace int) time.Duration {
+	if grace < 0 {
+		grace = 0
+	}
+	return time.Duration(2*grace+2) * window
+}
+
+// RedisOption configures optional RedisSpentStore behaviour.
+type RedisOption func(*RedisSpentStore)
+
+// WithRedisPassword authenticates every connection with AUTH password.
+func WithRedisPassword(password string) RedisOption {
+	return func(s *RedisSpentStore) { s.password = password }
+}
+
+// WithRedisDB selects database db on every connection.
+func WithRedisDB(db int) RedisOption {
+	return func(s *RedisSpentStore) { s.db = db }
+}
+
+// WithRedisKeyPrefix sets the prefix of the Redis keys, "ppassrc:spent:" by
+// default. Each key is the prefix followed by the hex-encoded token value.
+func WithRedisKeyPrefix(prefix string) RedisOption {
+	return func(s *RedisSpentStore) { s.prefix = prefix }
+}
+
+// RedisSpentStore keeps the spent set in Redis, speaking RESP directly. A
+// spend is SET key 1 NX PX ttl, which Redis executes atomically, so issuers
+// on several hosts sharing one Redis accept each token at most once between
+// them. Entries expire after the TTL, which should be at least as long as
+// tokens stay valid (see SpentTTL); a TTL of zero keeps them forever.
+//
+// A RedisSpentStore is safe for concurrent use. It keeps a few connections
+// open between spends; Close closes them.
+type RedisSpentStore struct {
+	addr     string
+	ttl      time.Duration
+	password string
+	db       int
+	prefix   string
+	dialer   net.Dialer
+
+	mu     sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+// NewRedisSpentStore returns a store for the Redis server at addr
+// ("host:port") whose entries expire after ttl. Connections are made as
+// spends need them.
+func NewRedisSpentStore(addr string, ttl time.Duration, opts ...RedisOption) *RedisSpentStore {
+	s := &RedisSpentStore{addr: addr, ttl: ttl, prefix: "ppassrc:spent:"}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Spend implements SpentStore.
+func (s *RedisSpentStore) Spend(key []byte) (bool, error) {
+	return s.SpendContext(context.Background(), key)
+}
+
+// SpendContext implements SpentStoreContext. If ctx ends while the reply is
+// outstanding, the key may still have been recorded.
+func (s *RedisSpentStore) SpendContext(ctx context.Context, key []byte) (bool, error) {
+	args := []string{"SET", s.prefix + hex.EncodeToString(key), "1", "NX"}
+	if s.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(s.ttl.Milliseconds(), 1), 10))
+	}
+
+	c, err := s.conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	reply, err := c.do(ctx, args...)
+	if err != nil {
+		c.Close()
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return false, err
+	}
+	s.put(c)
+
+	switch reply := reply.(type) {
+	case string:
+		if reply != "OK" {
+			return false, fmt.Errorf("%w: unexpected SET reply %q", ErrRedis, reply)
+		}
+		return true, nil
+	case nil:
+		return false, nil
+	case error:
+		return false, reply
+	default:
+		return false, fmt.Errorf("%w: unexpected SET reply %v", ErrRedis, reply)
+	}
+}
+
+// Close closes the idle connections; spends in progress close theirs when
+// they finish.
+func (s *RedisSpentStore) Close() error {
+	s.mu.Lock()
+	idle := s.idle
+	s.idle, s.closed = nil, true
+	s.mu.Unlock()
+
+	var err error
+	for _, c := range idle {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+func (s *RedisSpentStore) conn(ctx context.Context) (*redisConn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errors.New("ppassrc: redis spent store closed")
+	}
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+
+	nc, err := s.dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if s.password != "" {
+		if err := c.expectOK(ctx, "AUTH", s.password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if err := c.expectOK(ctx, "SELECT", strconv.Itoa(s.db)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if c.expired {
+		c.Close()
+		return nil, ctx.Err()
+	}
+	return c, nil
+}
+
+func (s *RedisSpentStore) put(c *redisConn) {
+	s.mu.Lock()
+	if !s.closed && !c.expired && len(s.idle) < redisMaxIdle {
+		s.idle = append(s.idle, c)
+		c = nil
+	}
+	s.mu.Unlock()
+	if c != nil {
+		c.Close()
+	}
+}
+
+// redisConn is one RESP connection. Replies decode to string (simple
+// string), []byte (bulk string), int64, nil (null) or error (error reply, not
+// a failure of the connection).
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	// expired is set when ctx ended during a command that still completed;
+	// the deadline set to interrupt it may fail the next command, so the
+	// connection must not be reused.
+	expired bool
+}
+
+// do sends a command and reads its reply, giving up when ctx ends. An error
+// return leaves the connection in an unknown state.
+func (c *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	c.SetDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Unix(1, 0)) })
+
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, a := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(a), a)
+	}
+	var reply any
+	_, err := c.Write(buf)
+	if err == nil {
+		reply, err = c.readReply()
+	}
+	if !stop() {
+		c.expired = true
+	}
+	return reply, err
+}
+
+func (c *redisConn) expectOK(ctx context.Context, args ...string) error {
+	reply, err := c.do(ctx, args...)
+	if err != nil {
+		return err
+	}
+	if e, ok := reply.(error); ok {
+		return fmt.Errorf("%s: %w", args[0], e)
+	}
+	if reply != "OK" {
+		return fmt.Errorf("%w: unexpected %s reply %v", ErrRedis, args[0], reply)
+	}
+	return nil
+}
+
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: malformed reply %q", ErrRedis, line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return fmt.Errorf("%w: %s", ErrRedis, body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '_':
+		return nil, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed reply %q", ErrRedis, line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > redisMaxBulk {
+			return nil, fmt.Errorf("%w: %d byte reply too large", ErrRedis, n)
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported reply type %q", ErrRedis, kind)
+	}
+}
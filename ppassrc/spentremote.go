@@ -0,0 +1,140 @@
+package ppassrc
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SpendPath is the path served by NewSpentStoreHandler. It takes a POST with
+// the spent-store key as an application/octet-stream body.
+const SpendPath = "/spend"
+
+// SpentSecretHeader carries the shared secret set with WithSpentStoreSecret
+// and WithHTTPSpentStoreSecret.
+const SpentSecretHeader = "Ppassrc-Spent-Secret"
+
+// DefaultSpentStoreTimeout bounds every spend made by an HTTPSpentStore
+// created without its own http.Client.
+const DefaultSpentStoreTimeout = 10 * time.Second
+
+// SpentStoreHandlerOption configures optional NewSpentStoreHandler behaviour.
+type SpentStoreHandlerOption func(*spentStoreHandler)
+
+// WithSpentStoreSecret makes the handler refuse, with 401, every request that
+// does not carry secret in SpentSecretHeader. An empty secret panics.
+func WithSpentStoreSecret(secret string) SpentStoreHandlerOption {
+	if secret == "" {
+		panic("ppassrc: empty spent store secret")
+	}
+	return func(h *spentStoreHandler) { h.secret = []byte(secret) }
+}
+
+type spentStoreHandler struct {
+	secret []byte
+}
+
+// NewSpentStoreHandler serves store over HTTP so that several redemption
+// nodes can share one spent set. A spend answers 200 when the key was unspent
+// and is now recorded, 409 when it was already spent and 503 when store
+// failed. The check and the record are one call to store.Spend, so the
+// protocol is an atomic check-and-set if store's Spend is; every store in
+// this package is.
+//
+// Anyone who can reach the handler can spend keys and so make tokens fail.
+// Without WithSpentStoreSecret it authenticates nobody and must only be
+// reachable from the redemption nodes, on a private network or behind mTLS;
+// the secret travels in clear, so over untrusted networks use it with TLS.
+func NewSpentStoreHandler(store SpentStore, opts ...SpentStoreHandlerOption) http.Handler {
+	var h spentStoreHandler
+	for _, opt := range opts {
+		opt(&h)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(SpendPath, func(w http.ResponseWriter, r *http.Request) {
+		if h.secret != nil && subtle.ConstantTimeCompare([]byte(r.Header.Get(SpentSecretHeader)), h.secret) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		key, ok := readHTTPBody(w, r)
+		if !ok {
+			return
+		}
+		if len(key) == 0 {
+			http.Error(w, "empty key", http.StatusBadRequest)
+			return
+		}
+
+		unspent, err := spendContext(r.Context(), store, key)
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case unspent:
+			io.WriteString(w, "spent\n")
+		default:
+			http.Error(w, "already spent", http.StatusConflict)
+		}
+	})
+	return mux
+}
+
+// HTTPSpentStore is a SpentStore kept by a server running
+// NewSpentStoreHandler. Issuers on several hosts that use HTTPSpentStores for
+// the same server accept each token at most once between them.
+//
+// A spend whose answer is lost, e.g. to a timeout, may still have been
+// recorded; the token is then rejected everywhere, which errs on the side of
+// refusing rather than accepting a double spend.
+type HTTPSpentStore struct {
+	url string
+	hc  *http.Client
+	hdr http.Header
+}
+
+// HTTPSpentStoreOption configures optional HTTPSpentStore behaviour.
+type HTTPSpentStoreOption func(*HTTPSpentStore)
+
+// WithHTTPSpentStoreSecret sends secret in SpentSecretHeader with every
+// spend, for a server using WithSpentStoreSecret.
+func WithHTTPSpentStoreSecret(secret string) HTTPSpentStoreOption {
+	return func(s *HTTPSpentStore) { s.hdr.Set(SpentSecretHeader, secret) }
+}
+
+// NewHTTPSpentStore returns a client for the spent store at baseURL. A nil hc
+// means a client with DefaultSpentStoreTimeout, so that an unresponsive
+// server rejects tokens instead of stalling redemptions.
+func NewHTTPSpentStore(baseURL string, hc *http.Client, opts ...HTTPSpentStoreOption) *HTTPSpentStore {
+	if hc == nil {
+		hc = &http.Client{Timeout: DefaultSpentStoreTimeout}
+	}
+	s := &HTTPSpentStore{url: strings.TrimSuffix(baseURL, "/") + SpendPath, hc: hc, hdr: make(http.Header)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Spend implements SpentStore.
+func (s *HTTPSpentStore) Spend(key []byte) (bool, error) {
+	return s.SpendContext(context.Background(), key)
+}
+
+// SpendContext implements SpentStoreContext.
+func (s *HTTPSpentStore) SpendContext(ctx context.Context, key []byte) (bool, error) {
+	status, body, err := postHTTP(ctx, s.hc, s.url, key, s.hdr)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	default:
+		return false, fmt.Errorf("ppassrc: spend: %d %s", status, body)
+	}
+}
@@ -7,6 +7,15 @@ type BlindedToken struct {
 	Blinded []byte
 }
 
+// IssuanceRequest is a blinded token together with request-scoped metadata
+// (peer address, account, ...) that policy layers in front of the issuer may
+// inspect, and the attestation evidence to present to the issuer.
+type IssuanceRequest struct {
+	Blinded  BlindedToken
+	Metadata map[string]string
+	Evidence Evidence
+}
+
 // Evaluation is the issuer's VOPRF evaluation response (serialized).
 type Evaluation struct {
 	Eval []byte
@@ -19,8 +28,18 @@ type Token struct {
 }
 
 // RequestAux stores client-side state needed between Request and Finalize.
+// It carries the blind, so Finalize can run in a different process than
+// Request; keep it secret. Its binary encoding is stable, so it can be
+// persisted to survive a client restart.
 type RequestAux struct {
-	Nonce []byte
+	Nonce   []byte
+	Context Context
+	Blind   []byte
+	Blinded []byte
+	// KeyID and Hctx record the issuer key and Hctx version the request was
+	// made for; Finalize refuses state made for others, or recording neither.
+	KeyID []byte
+	Hctx  HctxVersion
 }
 
 // Context is the redemption context (epoch, origin, etc.).
@@ -33,4 +52,4 @@ func NewContextRandomEpoch() Context {
 	b := make([]byte, 32)
 	_, _ = rand.Read(b)
 	return Context(append([]byte("epoch:"), b...))
-}
\ No newline at end of file
+}
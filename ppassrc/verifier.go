@@ -0,0 +1,116 @@
+package ppassrc
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/bytemare/voprf"
+)
+
+// Verifier redeems tokens: it checks the PRF output of each token for its
+// redemption context and enforces one-time use through its spent store. It is
+// the redemption half of an Issuer and holds the issuer's secret key, since
+// tokens are privately verifiable; hosts that must not be able to mint tokens
+// use a RemoteVerifier instead. It is safe for concurrent use if its spent
+// store and hooks are.
+type Verifier struct {
+	cs       voprf.Identifier
+	sk       []byte
+	pk       []byte
+	hctx     HctxVersion
+	spent    SpentStore
+	metrics  Instrumentation
+	hooks    []EventHook
+	audits   []*AuditLog
+	keyLabel string
+
+	// servers holds VOPRF servers for the key. A voprf.Server reuses one
+	// hash state across calls, so each one serves one call at a time.
+	servers sync.Pool
+}
+
+func newVerifier(cs voprf.Identifier, sk []byte) (*Verifier, error) {
+	srv, err := cs.Server(voprf.VOPRF, sk)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Verifier{
+		cs:    cs,
+		sk:    srv.PrivateKey(),
+		pk:    srv.PublicKey(),
+		hctx:  HctxV1,
+		spent: NewMemorySpentStore(),
+	}
+	v.servers.New = func() any {
+		// sk was accepted above, so this cannot fail.
+		srv, _ := cs.Server(voprf.VOPRF, v.sk)
+		return srv
+	}
+	v.servers.Put(srv)
+	v.keyLabel = hex.EncodeToString(KeyID(v.pk))
+	return v, nil
+}
+
+// VerificationKey returns the issuer's encoded public key (to give to clients).
+func (v *Verifier) VerificationKey() []byte {
+	return v.pk
+}
+
+// Redeem verifies the PRF output and enforces one-time-use (double-spend prevention).
+func (v *Verifier) Redeem(rctx Context, tok *Token) (bool, error) {
+	return v.RedeemContext(context.Background(), rctx, tok)
+}
+
+// RedeemContext is like Redeem but passes ctx to the spent store (see
+// SpentStoreContext), so a cancelled or expired ctx aborts the spent-set
+// lookup and the token is rejected with ctx's error.
+func (v *Verifier) RedeemContext(ctx context.Context, rctx Context, tok *Token) (bool, error) {
+	outcome, err := v.redeemOutcome(ctx, rctx, tok)
+	return outcome == OutcomeAccepted, err
+}
+
+// redeemOutcome redeems tok and reports the detailed outcome to the
+// configured instrumentation and hooks.
+func (v *Verifier) redeemOutcome(ctx context.Context, rctx Context, tok *Token) (Outcome, error) {
+	start := time.Now()
+	outcome, err := v.redeem(ctx, rctx, tok)
+	return v.observeRedeem(start, rctx, outcome, err)
+}
+
+func (v *Verifier) redeem(ctx context.Context, rctx Context, tok *Token) (Outcome, error) {
+	if !v.verify(rctx, tok) {
+		return OutcomeInvalid, nil
+	}
+	return v.spend(ctx, tok)
+}
+
+// verify checks PRF validity of tok for rctx under the issuer's key.
+func (v *Verifier) verify(rctx Context, tok *Token) bool {
+	msg := v.hctx.Hash(rctx, tok.Nonce)
+	srv := v.servers.Get().(*voprf.Server)
+	defer v.servers.Put(srv)
+	return srv.VerifyFinalize(msg, nil, tok.Value)
+}
+
+// spend marks tok as spent, reporting OutcomeDoubleSpend if it already was.
+func (v *Verifier) spend(ctx context.Context, tok *Token) (Outcome, error) {
+	ok, err := spendContext(ctx, v.spent, tok.Value)
+	switch {
+	case err != nil:
+		return OutcomeError, err
+	case !ok:
+		return OutcomeDoubleSpend, nil
+	}
+	return OutcomeAccepted, nil
+}
+
+// ResetForBench just clears spent state for a given token (used by benchmarks).
+// It only has an effect on spent stores that support deletion.
+func (v *Verifier) ResetForBench(tok *Token) {
+	if d, ok := v.spent.(interface{ Delete(key []byte) }); ok {
+		d.Delete(tok.Value)
+	}
+}
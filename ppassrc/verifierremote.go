@@ -0,0 +1,85 @@
+package ppassrc
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultVerifierTimeout bounds every redemption made by a RemoteVerifier
+// without WithVerifierHTTPClient.
+const DefaultVerifierTimeout = 10 * time.Second
+
+// RemoteVerifier redeems tokens on hosts that must not be able to mint them.
+// Tokens are privately verifiable: checking one takes the issuer's secret
+// key. A RemoteVerifier holds no secret; it asks the issuer, or a
+// verification service running NewVerifierHandler with the issuer's key, to
+// redeem each token and reports the answer. The spent set is the server's.
+// It is safe for concurrent use if its hooks are.
+type RemoteVerifier struct {
+	url      string
+	hc       *http.Client
+	metrics  Instrumentation
+	hooks    []EventHook
+	keyLabel string
+}
+
+// VerifierOption configures optional RemoteVerifier behaviour.
+type VerifierOption func(*RemoteVerifier)
+
+// WithVerifierHTTPClient makes the verifier use hc instead of a client with
+// DefaultVerifierTimeout.
+func WithVerifierHTTPClient(hc *http.Client) VerifierOption {
+	return func(v *RemoteVerifier) { v.hc = hc }
+}
+
+// WithVerifierInstrumentation reports redemption outcomes and latencies, as
+// seen from the verifier, to in.
+func WithVerifierInstrumentation(in Instrumentation) VerifierOption {
+	return func(v *RemoteVerifier) { v.metrics = in }
+}
+
+// WithVerifierEventHook adds h to the hooks called for every redemption.
+func WithVerifierEventHook(h EventHook) VerifierOption {
+	return func(v *RemoteVerifier) { v.hooks = append(v.hooks, h) }
+}
+
+// NewRemoteVerifier returns a verifier for tokens of the issuer public key
+// pk, redeemed by the server at baseURL (NewHTTPHandler or
+// NewVerifierHandler). pk only labels events and metrics.
+func NewRemoteVerifier(baseURL string, pk []byte, opts ...VerifierOption) *RemoteVerifier {
+	v := &RemoteVerifier{
+		url:      strings.TrimSuffix(baseURL, "/") + RedeemPath,
+		hc:       &http.Client{Timeout: DefaultVerifierTimeout},
+		keyLabel: hex.EncodeToString(KeyID(pk)),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Redeem asks the server to redeem tok for rctx. Like Issuer.Redeem it
+// reports an invalid or already spent token as (false, nil); a server that
+// cannot be reached or cannot decide rejects the token with an error.
+func (v *RemoteVerifier) Redeem(rctx Context, tok *Token) (bool, error) {
+	return v.RedeemContext(context.Background(), rctx, tok)
+}
+
+// RedeemContext is like Redeem but gives up once ctx is done.
+func (v *RemoteVerifier) RedeemContext(ctx context.Context, rctx Context, tok *Token) (bool, error) {
+	start := time.Now()
+	outcome, err := redeemHTTP(ctx, v.hc, v.url, rctx, tok)
+	if v.metrics != nil {
+		v.metrics.ObserveRedeem(v.keyLabel, outcome, time.Since(start))
+	}
+	if len(v.hooks) > 0 {
+		ev := Event{Time: start, Op: "redeem", KeyID: v.keyLabel, Outcome: outcome, ContextDigest: ContextDigest(rctx)}
+		for _, h := range v.hooks {
+			h(ev)
+		}
+	}
+	return outcome == OutcomeAccepted, err
+}
@@ -0,0 +1,69 @@
+package ppassrc
+
+import (
+	"context"
+	"time"
+)
+
+// WindowMatch reports the time window a token was redeemed under.
+type WindowMatch struct {
+	Offset  int       // windows relative to the one containing now (-1 is the previous window)
+	Start   time.Time // start of the matching window
+	Context Context
+}
+
+// RedeemTimeWindow redeems tok against NewContextTimeWindow contexts, accepting
+// the window containing now and up to grace adjacent windows on either side,
+// so tokens minted just before a boundary or by a client with a skewed clock
+// still redeem. Windows are tried nearest first. The token is spent at most
+// once across all accepted windows.
+func (v *Verifier) RedeemTimeWindow(now time.Time, window time.Duration, grace int, tok *Token) (*WindowMatch, bool, error) {
+	return v.RedeemTimeWindowContext(context.Background(), now, window, grace, tok)
+}
+
+// RedeemTimeWindowContext is like RedeemTimeWindow but passes ctx to the
+// spent store, as RedeemContext does.
+func (v *Verifier) RedeemTimeWindowContext(ctx context.Context, now time.Time, window time.Duration, grace int, tok *Token) (*WindowMatch, bool, error) {
+	if window <= 0 {
+		panic("ppassrc: window must be positive")
+	}
+	if grace < 0 {
+		grace = 0
+	}
+
+	start := time.Now()
+	match, outcome, err := v.redeemTimeWindow(ctx, now, window, grace, tok)
+	rctx := NewContextTimeWindow(now, window)
+	if match != nil {
+		rctx = match.Context
+	}
+	outcome, err = v.observeRedeem(start, rctx, outcome, err)
+	return match, outcome == OutcomeAccepted, err
+}
+
+func (v *Verifier) redeemTimeWindow(ctx context.Context, now time.Time, window time.Duration, grace int, tok *Token) (*WindowMatch, Outcome, error) {
+	bucket := now.UnixNano() / window.Nanoseconds()
+	for _, off := range graceOffsets(grace) {
+		start := time.Unix(0, (bucket+int64(off))*window.Nanoseconds()).In(now.Location())
+		rctx := NewContextTimeWindow(start, window)
+		if !v.verify(rctx, tok) {
+			continue
+		}
+		outcome, err := v.spend(ctx, tok)
+		if outcome != OutcomeAccepted {
+			return nil, outcome, err
+		}
+		return &WindowMatch{Offset: off, Start: start, Context: rctx}, outcome, nil
+	}
+	return nil, OutcomeInvalid, nil
+}
+
+// graceOffsets lists window offsets nearest first: 0, -1, 1, -2, 2, ...
+func graceOffsets(grace int) []int {
+	offs := make([]int, 0, 2*grace+1)
+	offs = append(offs, 0)
+	for i := 1; i <= grace; i++ {
+		offs = append(offs, -i, i)
+	}
+	return offs
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+func TestIssueRequiresAttestation(t *testing.T) {
+	captcha := ppassrc.NewTestAttester("captcha", []byte("solved"))
+	issuer, err := ppassrc.NewIssuer(ppassrc.WithAttester(captcha))
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	ctx := ppassrc.NewContextRandomEpoch()
+
+	b, aux, _ := client.Request(ctx)
+
+	if _, err := issuer.Issue(b); !errors.Is(err, ppassrc.ErrAttestationFailed) {
+		t.Fatalf("issuance without evidence should fail attestation, got %v", err)
+	}
+
+	bad := ppassrc.Evidence{"captcha": []byte("guessed")}
+	if _, err := issuer.IssueWithEvidence(b, bad); !errors.Is(err, ppassrc.ErrAttestationFailed) {
+		t.Fatalf("issuance with wrong evidence should fail attestation, got %v", err)
+	}
+
+	good := ppassrc.Evidence{"captcha": []byte("solved")}
+	ev, err := issuer.IssueWithEvidence(b, good)
+	if err != nil {
+		t.Fatalf("IssueWithEvidence: %v", err)
+	}
+	tok, err := client.Finalize(ev, aux)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if ok, _ := issuer.Redeem(ctx, tok); !ok {
+		t.Fatal("attested token failed to redeem")
+	}
+}
+
+func TestComposedAttesters(t *testing.T) {
+	captcha := ppassrc.NewTestAttester("captcha", []byte("solved"))
+	device := ppassrc.NewTestAttester("device", []byte("trusted"))
+	login := ppassrc.NewTestAttester("login", []byte("session"))
+
+	// Either a logged-in session, or a solved CAPTCHA on a trusted device.
+	policy := ppassrc.AnyOf(login, ppassrc.AllOf(captcha, device))
+
+	cases := []struct {
+		name string
+		ev   ppassrc.Evidence
+		ok   bool
+	}{
+		{"none", nil, false},
+		{"login", ppassrc.Evidence{"login": []byte("session")}, true},
+		{"captcha only", ppassrc.Evidence{"captcha": []byte("solved")}, false},
+		{"captcha and device", ppassrc.Evidence{"captcha": []byte("solved"), "device": []byte("trusted")}, true},
+		{"captcha and untrusted device", ppassrc.Evidence{"captcha": []byte("solved"), "device": []byte("rooted")}, false},
+	}
+
+	for _, tc := range cases {
+		err := policy.Attest(tc.ev)
+		if tc.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.ok && !errors.Is(err, ppassrc.ErrAttestationFailed) {
+			t.Errorf("%s: expected ErrAttestationFailed, got %v", tc.name, err)
+		}
+	}
+}
+
+// Empty composites fail closed.
+func TestEmptyComposedAttesters(t *testing.T) {
+	ev := ppassrc.Evidence{"captcha": []byte("solved")}
+	for name, a := range map[string]ppassrc.Attester{"AllOf": ppassrc.AllOf(), "AnyOf": ppassrc.AnyOf()} {
+		if err := a.Attest(ev); !errors.Is(err, ppassrc.ErrAttestationFailed) {
+			t.Errorf("%s(): err = %v, want ErrAttestationFailed", name, err)
+		}
+	}
+}
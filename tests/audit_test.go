@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+// auditedRun issues one token and redeems it twice (accept, double spend)
+// with the audit log attached, returning the log and the token.
+func auditedRun(t *testing.T, key []byte) (*bytes.Buffer, *ppassrc.AuditLog, *ppassrc.Token) {
+	t.Helper()
+	var buf bytes.Buffer
+	log := ppassrc.NewAuditLog(&buf, key)
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithEventHook(log.Hook()))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	ctx := ppassrc.NewContext([]byte("audit"))
+
+	b, aux, _ := client.Request(ctx)
+	ev, err := issuer.Issue(b)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	tok, _ := client.Finalize(ev, aux)
+	issuer.Redeem(ctx, tok)
+	issuer.Redeem(ctx, tok)
+	if err := log.Err(); err != nil {
+		t.Fatalf("audit log: %v", err)
+	}
+	return &buf, log, tok
+}
+
+func TestEventHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []ppassrc.Event
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithEventHook(func(ev ppassrc.Event) {
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	}))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	ctx := ppassrc.NewContext([]byte("hooks"))
+
+	b, aux, _ := client.Request(ctx)
+	ev, _ := issuer.Issue(b)
+	tok, _ := client.Finalize(ev, aux)
+	issuer.Redeem(ctx, tok)
+	issuer.Redeem(ctx, tok)
+	issuer.Redeem(ppassrc.NewContext([]byte("other")), tok)
+
+	want := []struct {
+		op      string
+		outcome ppassrc.Outcome
+	}{
+		{"issue", ppassrc.OutcomeIssued},
+		{"redeem", ppassrc.OutcomeAccepted},
+		{"redeem", ppassrc.OutcomeDoubleSpend},
+		{"redeem", ppassrc.OutcomeInvalid},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	keyID := hex.EncodeToString(issuer.KeyID())
+	for i, w := range want {
+		e := events[i]
+		if e.Op != w.op || e.Outcome != w.outcome {
+			t.Errorf("event %d = %s/%s, want %s/%s", i, e.Op, e.Outcome, w.op, w.outcome)
+		}
+		if e.KeyID != keyID {
+			t.Errorf("event %d key ID = %s, want %s", i, e.KeyID, keyID)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("event %d has no timestamp", i)
+		}
+	}
+	if events[0].ContextDigest != "" {
+		t.Error("issuance event carries a context digest")
+	}
+	if events[1].ContextDigest != ppassrc.ContextDigest(ctx) {
+		t.Error("redemption event has the wrong context digest")
+	}
+}
+
+func TestAuditLogVerifies(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("audit key")} {
+		buf, log, tok := auditedRun(t, key)
+
+		if strings.Contains(buf.String(), hex.EncodeToString(tok.Value)) {
+			t.Fatal("audit log contains the token value")
+		}
+		head, err := ppassrc.VerifyAuditLog(bytes.NewReader(buf.Bytes()), key)
+		if err != nil {
+			t.Fatalf("intact log rejected: %v", err)
+		}
+		if head.Entries != 3 {
+			t.Errorf("head has %d entries, want 3", head.Entries)
+		}
+		if want := log.Head(); !bytes.Equal(head.Hash, want.Hash) {
+			t.Error("verified head differs from the writer's head")
+		}
+	}
+}
+
+func TestAuditLogDetectsTampering(t *testing.T) {
+	key := []byte("audit key")
+	buf, _, _ := auditedRun(t, key)
+	lines := strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+	cases := map[string]string{
+		"altered outcome": strings.Replace(buf.String(), `"outcome":"double_spend"`, `"outcome":"accepted"`, 1),
+		"deleted entry":   lines[0] + lines[2],
+		"reordered":       lines[0] + lines[2] + "\n" + lines[1],
+		"garbage line":    lines[0] + "not json\n" + lines[1] + lines[2],
+	}
+	for name, log := range cases {
+		_, err := ppassrc.VerifyAuditLog(strings.NewReader(log), key)
+		if !errors.Is(err, ppassrc.ErrAuditLogTampered) {
+			t.Errorf("%s: err = %v, want ErrAuditLogTampered", name, err)
+		}
+	}
+
+	if _, err := ppassrc.VerifyAuditLog(bytes.NewReader(buf.Bytes()), []byte("wrong key")); !errors.Is(err, ppassrc.ErrAuditLogTampered) {
+		t.Errorf("wrong key: err = %v, want ErrAuditLogTampered", err)
+	}
+}
+
+func TestAuditLogResume(t *testing.T) {
+	key := []byte("audit key")
+	buf, _, _ := auditedRun(t, key)
+
+	head, err := ppassrc.VerifyAuditLog(bytes.NewReader(buf.Bytes()), key)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	log := ppassrc.ResumeAuditLog(buf, key, head)
+	if err := log.Record(ppassrc.Event{Op: "redeem", Outcome: ppassrc.OutcomeInvalid}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	head, err = ppassrc.VerifyAuditLog(bytes.NewReader(buf.Bytes()), key)
+	if err != nil {
+		t.Fatalf("resumed log rejected: %v", err)
+	}
+	if head.Entries != 4 {
+		t.Errorf("head has %d entries, want 4", head.Entries)
+	}
+}
+
+// failingWriter fails every write once broken is set.
+type failingWriter struct {
+	bytes.Buffer
+	broken bool
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.broken {
+		return 0, errors.New("disk full")
+	}
+	return w.Buffer.Write(p)
+}
+
+// With WithAuditLog, operations that cannot be recorded fail instead of
+// going through unaudited.
+func TestAuditLogFailsClosed(t *testing.T) {
+	var w failingWriter
+	log := ppassrc.NewAuditLog(&w, nil)
+	var outcomes []ppassrc.Outcome
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithAuditLog(log), ppassrc.WithEventHook(func(ev ppassrc.Event) {
+		outcomes = append(outcomes, ev.Outcome)
+	}))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	ctx := ppassrc.NewContext([]byte("audit"))
+
+	b, aux, _ := client.Request(ctx)
+	ev, err := issuer.Issue(b)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	tok, _ := client.Finalize(ev, aux)
+
+	w.broken = true
+	if ev, err := issuer.Issue(b); ev != nil || err == nil {
+		t.Errorf("unaudited issuance = %v, %v; want nil, error", ev, err)
+	}
+	if ok, err := issuer.Redeem(ctx, tok); ok || err == nil {
+		t.Errorf("unaudited redemption = %v, %v; want false, error", ok, err)
+	}
+	if log.Err() == nil {
+		t.Error("log did not keep the write error")
+	}
+
+	want := []ppassrc.Outcome{ppassrc.OutcomeIssued, ppassrc.OutcomeError, ppassrc.OutcomeError}
+	if len(outcomes) != len(want) {
+		t.Fatalf("hooks saw %v, want %v", outcomes, want)
+	}
+	for i := range want {
+		if outcomes[i] != want[i] {
+			t.Errorf("event %d outcome %s, want %s", i, outcomes[i], want[i])
+		}
+	}
+
+	// The failed redemption still spent the token.
+	w.broken = false
+	if ok, _ := issuer.Redeem(ctx, tok); ok {
+		t.Error("token accepted again after an unaudited redemption")
+	}
+}
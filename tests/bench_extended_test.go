@@ -201,16 +201,16 @@ func BenchmarkIssuanceScalingGOMAXPROCS(b *testing.B) {
 
 			ctx := ppassrc.NewContextRandomEpoch()
 
+			// One client shared by all goroutines, as in an application.
+			client, err := ppassrc.NewClient(issuer.VerificationKey())
+			if err != nil {
+				b.Fatalf("NewClient: %v", err)
+			}
+
 			b.ResetTimer()
 			b.RunParallel(func(pb *testing.PB) {
-				// FIX: Each goroutine must use its own client
-				localClient, err := ppassrc.NewClient(issuer.VerificationKey())
-				if err != nil {
-					b.Fatalf("NewClient: %v", err)
-				}
-
 				for pb.Next() {
-					bl, aux, err := localClient.Request(ctx)
+					bl, aux, err := client.Request(ctx)
 					if err != nil {
 						b.Fatalf("Request: %v", err)
 					}
@@ -218,7 +218,7 @@ func BenchmarkIssuanceScalingGOMAXPROCS(b *testing.B) {
 					if err != nil {
 						b.Fatalf("Issue: %v", err)
 					}
-					_, err = localClient.Finalize(eval, aux)
+					_, err = client.Finalize(eval, aux)
 					if err != nil {
 						b.Fatalf("Finalize: %v", err)
 					}
@@ -359,3 +359,75 @@ func BenchmarkIssuanceMemoryOverhead(b *testing.B) {
 		b.ReportMetric(delta, "bytes/op")
 	}
 }
+
+// ------------------------------
+// Spent-set memory per token
+// ------------------------------
+
+// BenchmarkSpentStoreMemory fills each spent-set variant with 2^16 random
+// token values and reports the heap it retains per token. "cuckoo-filter" is
+// the filter alone, i.e. what stays in memory in front of an exact store that
+// lives elsewhere.
+func BenchmarkSpentStoreMemory(b *testing.B) {
+	const tokens = 1 << 16
+	keys := randomKeys(tokens)
+
+	variants := []struct {
+		name  string
+		store func() ppassrc.SpentStore
+	}{
+		{"exact", func() ppassrc.SpentStore { return ppassrc.NewMemorySpentStore() }},
+		{"truncated", func() ppassrc.SpentStore { return ppassrc.NewTruncatedSpentStore() }},
+		{"filtered-truncated", func() ppassrc.SpentStore {
+			return ppassrc.NewFilteredSpentStore(ppassrc.NewTruncatedSpentStore(), tokens)
+		}},
+	}
+	for _, v := range variants {
+		b.Run(v.name, func(b *testing.B) {
+			benchmarkRetained(b, tokens, func() any {
+				s := v.store()
+				for _, k := range keys {
+					if ok, err := s.Spend(k); !ok || err != nil {
+						b.Fatalf("Spend = %v, %v", ok, err)
+					}
+				}
+				return s
+			})
+		})
+	}
+	b.Run("cuckoo-filter", func(b *testing.B) {
+		benchmarkRetained(b, tokens, func() any {
+			f := ppassrc.NewCuckooFilter(tokens)
+			for _, k := range keys {
+				if err := f.Insert(k); err != nil {
+					b.Fatalf("Insert: %v", err)
+				}
+			}
+			return f
+		})
+	})
+}
+
+// benchmarkRetained runs fill b.N times and reports the heap retained by the
+// value it returns, per token.
+func benchmarkRetained(b *testing.B, tokens int, fill func() any) {
+	var retained float64
+	var before, after runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		b.StartTimer()
+
+		v := fill()
+
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		runtime.KeepAlive(v)
+		retained += float64(int64(after.HeapAlloc) - int64(before.HeapAlloc))
+		b.StartTimer()
+	}
+	b.ReportMetric(retained/float64(b.N)/float64(tokens), "B/token")
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(tokens), "ns/token")
+}
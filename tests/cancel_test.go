@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ppassrc/ppassrc"
+)
+
+// slowSpentStore blocks every SpendContext until release is closed or the
+// context is done.
+type slowSpentStore struct {
+	*ppassrc.MemorySpentStore
+	release chan struct{}
+}
+
+func (s *slowSpentStore) SpendContext(ctx context.Context, key []byte) (bool, error) {
+	select {
+	case <-s.release:
+		return s.Spend(key)
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func TestRedeemContextDeadline(t *testing.T) {
+	store := &slowSpentStore{MemorySpentStore: ppassrc.NewMemorySpentStore(), release: make(chan struct{})}
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithSpentStore(store))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("deadline"))
+
+	b, aux, _ := client.Request(rctx)
+	ev, _ := issuer.Issue(b)
+	tok, _ := client.Finalize(ev, aux)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ok, err := issuer.RedeemContext(ctx, rctx, tok)
+	if ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RedeemContext = %v, %v; want false, DeadlineExceeded", ok, err)
+	}
+	if store.Len() != 0 {
+		t.Fatal("aborted redemption spent the token")
+	}
+
+	close(store.release)
+	if ok, err := issuer.RedeemContext(context.Background(), rctx, tok); !ok || err != nil {
+		t.Fatalf("redemption after abort = %v, %v; want accepted", ok, err)
+	}
+}
+
+func TestCancelledContexts(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("cancel"))
+
+	b, aux, _ := client.Request(rctx)
+	ev, _ := issuer.Issue(b)
+	tok, _ := client.Finalize(ev, aux)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := client.RequestContext(ctx, rctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("RequestContext: err = %v, want Canceled", err)
+	}
+	if _, err := issuer.IssueContext(ctx, b); !errors.Is(err, context.Canceled) {
+		t.Errorf("IssueContext: err = %v, want Canceled", err)
+	}
+	if _, err := client.FinalizeContext(ctx, ev, aux); !errors.Is(err, context.Canceled) {
+		t.Errorf("FinalizeContext: err = %v, want Canceled", err)
+	}
+	// The default in-memory store does not implement SpentStoreContext; the
+	// issuer still checks ctx before spending.
+	if ok, err := issuer.RedeemContext(ctx, rctx, tok); ok || !errors.Is(err, context.Canceled) {
+		t.Errorf("RedeemContext = %v, %v; want false, Canceled", ok, err)
+	}
+
+	quota := ppassrc.NewQuotaIssuer(issuer, ppassrc.IdentityFromMetadata("user"), ppassrc.NewTokenBucket(1, time.Hour, 1))
+	req := ppassrc.IssuanceRequest{Blinded: b, Metadata: map[string]string{"user": "alice"}}
+	if _, err := quota.IssueContext(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Errorf("QuotaIssuer.IssueContext: err = %v, want Canceled", err)
+	}
+	if _, err := quota.Issue(req); err != nil {
+		t.Errorf("cancelled request was charged to the quota: %v", err)
+	}
+
+	if ok, err := issuer.Redeem(rctx, tok); !ok || err != nil {
+		t.Fatalf("Redeem after cancelled attempts = %v, %v; want accepted", ok, err)
+	}
+}
+
+// slowAttester blocks every AttestContext until the context is done.
+type slowAttester struct{}
+
+func (slowAttester) Attest(ppassrc.Evidence) error { return nil }
+
+func (slowAttester) AttestContext(ctx context.Context, _ ppassrc.Evidence) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestAttesterContext(t *testing.T) {
+	slow := slowAttester{}
+	for name, att := range map[string]ppassrc.Attester{
+		"direct": slow,
+		"AllOf":  ppassrc.AllOf(slow),
+		"AnyOf":  ppassrc.AnyOf(ppassrc.NewTestAttester("captcha"), slow),
+	} {
+		issuer, _ := ppassrc.NewIssuer(ppassrc.WithAttester(att))
+		client, _ := ppassrc.NewClient(issuer.VerificationKey())
+		b, _, _ := client.Request(ppassrc.NewContext([]byte("attest")))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := issuer.IssueWithEvidenceContext(ctx, b, ppassrc.Evidence{"captcha": []byte("ok")})
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: err = %v, want DeadlineExceeded", name, err)
+		}
+	}
+
+	// An attester without AttestContext is not called once ctx is done.
+	calls := 0
+	plain := ppassrc.AttesterFunc(func(ppassrc.Evidence) error {
+		calls++
+		return nil
+	})
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithAttester(plain))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	b, _, _ := client.Request(ppassrc.NewContext([]byte("attest")))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := issuer.IssueWithEvidenceContext(ctx, b, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("plain attester: err = %v, want Canceled", err)
+	}
+	if calls != 0 {
+		t.Error("attester was called with a cancelled context")
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+// Many requests outstanding on one client finalize correctly in any order.
+func TestClientOutstandingRequests(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("outstanding"))
+
+	const n = 16
+	blinded := make([]ppassrc.BlindedToken, n)
+	auxes := make([]ppassrc.RequestAux, n)
+	for i := range blinded {
+		var err error
+		if blinded[i], auxes[i], err = client.Request(rctx); err != nil {
+			t.Fatalf("Request %d: %v", i, err)
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		eval, err := issuer.Issue(blinded[i])
+		if err != nil {
+			t.Fatalf("Issue %d: %v", i, err)
+		}
+		tok, err := client.Finalize(eval, auxes[i])
+		if err != nil {
+			t.Fatalf("Finalize %d: %v", i, err)
+		}
+		if ok, err := issuer.Redeem(rctx, tok); !ok || err != nil {
+			t.Fatalf("token %d rejected: %v", i, err)
+		}
+	}
+}
+
+// One client shared by many goroutines; run with -race.
+func TestClientConcurrentUse(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithHctxVersion(ppassrc.HctxV2))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey(), ppassrc.WithClientHctxVersion(ppassrc.HctxV2))
+	rctx := ppassrc.NewContext([]byte("concurrent"))
+
+	const goroutines, perGoroutine = 8, 10
+	tokens := make(chan *ppassrc.Token, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				b, aux, err := client.Request(rctx)
+				if err != nil {
+					t.Errorf("Request: %v", err)
+					return
+				}
+				eval, err := issuer.Issue(b)
+				if err != nil {
+					t.Errorf("Issue: %v", err)
+					return
+				}
+				tok, err := client.Finalize(eval, aux)
+				if err != nil {
+					t.Errorf("Finalize: %v", err)
+					return
+				}
+				tokens <- tok
+			}
+		}()
+	}
+	wg.Wait()
+	close(tokens)
+
+	for tok := range tokens {
+		if ok, err := issuer.Redeem(rctx, tok); !ok || err != nil {
+			t.Fatalf("token from concurrent issuance rejected: %v", err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"ppassrc/ppassrc"
+)
+
+func TestHctxV2SeparatesContextAndNonce(t *testing.T) {
+	ctxA, nonceA := ppassrc.NewContext([]byte("epoch:ab")), []byte("c")
+	ctxB, nonceB := ppassrc.NewContext([]byte("epoch:a")), []byte("bc")
+
+	if !bytes.Equal(ppassrc.Hctx(ctxA, nonceA), ppassrc.Hctx(ctxB, nonceB)) {
+		t.Fatal("expected the legacy encoding to collide on shifted boundaries")
+	}
+	if !bytes.Equal(ppassrc.HctxV1.Hash(ctxA, nonceA), ppassrc.Hctx(ctxA, nonceA)) {
+		t.Fatal("HctxV1 must match the legacy Hctx")
+	}
+	if bytes.Equal(ppassrc.HctxV2.Hash(ctxA, nonceA), ppassrc.HctxV2.Hash(ctxB, nonceB)) {
+		t.Fatal("HctxV2 collides on shifted boundaries")
+	}
+}
+
+// Unknown Hctx versions are refused rather than treated as HctxV1.
+func TestHctxUnknownVersion(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	for _, v := range []ppassrc.HctxVersion{0, 3, 255} {
+		if _, err := ppassrc.NewIssuer(ppassrc.WithHctxVersion(v)); err == nil {
+			t.Errorf("NewIssuer accepted Hctx version %d", v)
+		}
+		if _, err := ppassrc.NewClient(issuer.VerificationKey(), ppassrc.WithClientHctxVersion(v)); err == nil {
+			t.Errorf("NewClient accepted Hctx version %d", v)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Hash under Hctx version %d did not panic", v)
+				}
+			}()
+			v.Hash(ppassrc.NewContext([]byte("ctx")), []byte("nonce"))
+		}()
+	}
+}
+
+// Under HctxV1 a token for ctx "...X" can be replayed under the shorter
+// context "..." by moving the trailing byte into the nonce; HctxV2 blocks it.
+func TestHctxV2BlocksBoundaryShift(t *testing.T) {
+	for _, v := range []ppassrc.HctxVersion{ppassrc.HctxV1, ppassrc.HctxV2} {
+		issuer, _ := ppassrc.NewIssuer(ppassrc.WithHctxVersion(v))
+		client, _ := ppassrc.NewClient(issuer.VerificationKey(), ppassrc.WithClientHctxVersion(v))
+
+		ctx := ppassrc.NewContext([]byte("origin:example.com/X"))
+		b, aux, _ := client.Request(ctx)
+		ev, _ := issuer.Issue(b)
+		tok, _ := client.Finalize(ev, aux)
+
+		shifted := &ppassrc.Token{
+			Value: tok.Value,
+			Nonce: append([]byte("X"), tok.Nonce...),
+		}
+		ok, _ := issuer.Redeem(ppassrc.NewContext([]byte("origin:example.com/")), shifted)
+		if v == ppassrc.HctxV1 && !ok {
+			t.Fatal("expected the legacy encoding to accept the shifted token")
+		}
+		if v == ppassrc.HctxV2 && ok {
+			t.Fatal("HctxV2 accepted a token under a different context")
+		}
+	}
+}
+
+func TestContextBuilder(t *testing.T) {
+	a := ppassrc.NewContextBuilder().Origin("example.com").Epoch(7).Action("login").Build()
+	b := ppassrc.NewContextBuilder().Action("login").Epoch(7).Origin("example.com").Build()
+	if !bytes.Equal(a, b) {
+		t.Fatal("field order changed the encoding")
+	}
+
+	distinct := []ppassrc.Context{
+		a,
+		ppassrc.NewContextBuilder().Origin("example.co").Scope("m").Epoch(7).Action("login").Build(),
+		ppassrc.NewContextBuilder().Origin("example.com").Epoch(8).Action("login").Build(),
+		ppassrc.NewContextBuilder().Origin("example.com").Epoch(7).Scope("login").Build(),
+		ppassrc.NewContextBuilder().Origin("example.comlogin").Epoch(7).Build(),
+		ppassrc.NewContextBuilder().Origin("example.com").Action("login").Build(),
+	}
+	for i := range distinct {
+		for j := i + 1; j < len(distinct); j++ {
+			if bytes.Equal(distinct[i], distinct[j]) {
+				t.Fatalf("contexts %d and %d encode identically", i, j)
+			}
+		}
+	}
+
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithHctxVersion(ppassrc.HctxV2))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey(), ppassrc.WithClientHctxVersion(ppassrc.HctxV2))
+
+	bl, aux, _ := client.Request(a)
+	ev, _ := issuer.Issue(bl)
+	tok, _ := client.Finalize(ev, aux)
+
+	if ok, _ := issuer.Redeem(distinct[2], tok); ok {
+		t.Fatal("token redeemed under a different epoch")
+	}
+	if ok, _ := issuer.Redeem(b, tok); !ok {
+		t.Fatal("token failed to redeem under an equivalent context")
+	}
+}
+
+func TestCalendarPeriodID(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+
+	// 2025-12-31 23:30 UTC is already 2026-01-01 in Berlin.
+	ts := time.Date(2025, time.December, 31, 23, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		period ppassrc.CalendarPeriod
+		loc    *time.Location
+		want   string
+	}{
+		{ppassrc.PeriodDay, nil, "2025-12-31"},
+		{ppassrc.PeriodDay, berlin, "2026-01-01"},
+		{ppassrc.PeriodISOWeek, nil, "2026-W01"},
+		{ppassrc.PeriodMonth, nil, "2025-12"},
+		{ppassrc.PeriodMonth, berlin, "2026-01"},
+		{ppassrc.PeriodQuarter, nil, "2025-Q4"},
+		{ppassrc.PeriodQuarter, berlin, "2026-Q1"},
+	}
+	for _, tc := range cases {
+		if got := ppassrc.CalendarPeriodID(ts, tc.period, tc.loc); got != tc.want {
+			t.Errorf("%s in %v: got %s, want %s", tc.period, tc.loc, got, tc.want)
+		}
+	}
+}
+
+func TestCalendarContexts(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+
+	start := time.Date(2025, time.November, 1, 0, 0, 0, 0, berlin)
+	end := time.Date(2025, time.November, 30, 23, 59, 59, 0, berlin)
+
+	month := ppassrc.NewContextCalendar(start, ppassrc.PeriodMonth, berlin)
+	if !bytes.Equal(month, ppassrc.NewContextCalendar(end, ppassrc.PeriodMonth, berlin)) {
+		t.Fatal("same Berlin month produced different contexts")
+	}
+	if bytes.Equal(month, ppassrc.NewContextCalendar(start, ppassrc.PeriodMonth, time.UTC)) {
+		t.Fatal("month context ignores the location")
+	}
+	if bytes.Equal(month, ppassrc.NewContextCalendar(start, ppassrc.PeriodQuarter, berlin)) {
+		t.Fatal("month and quarter contexts collide")
+	}
+
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+
+	b, aux, _ := client.Request(month)
+	ev, _ := issuer.Issue(b)
+	tok, _ := client.Finalize(ev, aux)
+
+	december := ppassrc.NewContextCalendar(end.Add(time.Second), ppassrc.PeriodMonth, berlin)
+	if ok, _ := issuer.Redeem(december, tok); ok {
+		t.Fatal("November entitlement redeemed in December")
+	}
+	if ok, _ := issuer.Redeem(ppassrc.NewContextCalendar(end, ppassrc.PeriodMonth, berlin), tok); !ok {
+		t.Fatal("November entitlement rejected at the end of November")
+	}
+}
@@ -0,0 +1,233 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+// A request made by one client can be finalized by a fresh client after the
+// messages and request state went through their binary encodings.
+func TestEncodedIssuanceAcrossClients(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	pub, err := ppassrc.UnmarshalPublicKey(ppassrc.MarshalPublicKey(issuer.VerificationKey()))
+	if err != nil {
+		t.Fatalf("UnmarshalPublicKey: %v", err)
+	}
+
+	requester, _ := ppassrc.NewClient(pub)
+	ctx := ppassrc.NewContextRandomEpoch()
+	b, aux, _ := requester.Request(ctx)
+
+	rawB, _ := b.MarshalBinary()
+	rawAux, _ := aux.MarshalBinary()
+
+	var gotB ppassrc.BlindedToken
+	if err := gotB.UnmarshalBinary(rawB); err != nil {
+		t.Fatalf("BlindedToken.UnmarshalBinary: %v", err)
+	}
+	ev, err := issuer.Issue(gotB)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	rawEv, _ := ev.MarshalBinary()
+
+	var gotEv ppassrc.Evaluation
+	if err := gotEv.UnmarshalBinary(rawEv); err != nil {
+		t.Fatalf("Evaluation.UnmarshalBinary: %v", err)
+	}
+	var gotAux ppassrc.RequestAux
+	if err := gotAux.UnmarshalBinary(rawAux); err != nil {
+		t.Fatalf("RequestAux.UnmarshalBinary: %v", err)
+	}
+
+	finalizer, _ := ppassrc.NewClient(pub)
+	tok, err := finalizer.Finalize(&gotEv, gotAux)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+
+	rawTok, _ := tok.MarshalBinary()
+	var gotTok ppassrc.Token
+	if err := gotTok.UnmarshalBinary(rawTok); err != nil {
+		t.Fatalf("Token.UnmarshalBinary: %v", err)
+	}
+	if ok, _ := issuer.Redeem(ctx, &gotTok); !ok {
+		t.Fatal("token finalized by a fresh client failed to redeem")
+	}
+}
+
+func TestIssuerKeyRoundTrip(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	restored, err := ppassrc.NewIssuerFromKey(issuer.MarshalKey())
+	if err != nil {
+		t.Fatalf("NewIssuerFromKey: %v", err)
+	}
+	if !bytes.Equal(restored.VerificationKey(), issuer.VerificationKey()) {
+		t.Fatal("restored issuer has a different public key")
+	}
+	if !bytes.Equal(restored.KeyID(), issuer.KeyID()) {
+		t.Fatal("restored issuer has a different key ID")
+	}
+
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	ctx := ppassrc.NewContextRandomEpoch()
+	b, aux, _ := client.Request(ctx)
+	ev, _ := issuer.Issue(b)
+	tok, _ := client.Finalize(ev, aux)
+
+	if ok, _ := restored.Redeem(ctx, tok); !ok {
+		t.Fatal("restored issuer rejected a token minted before the restore")
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	b, _, _ := client.Request(ppassrc.NewContextRandomEpoch())
+	raw, _ := b.MarshalBinary()
+
+	var tok ppassrc.Token
+	var bt ppassrc.BlindedToken
+	cases := map[string]error{
+		"empty":         bt.UnmarshalBinary(nil),
+		"wrong type":    tok.UnmarshalBinary(raw),
+		"truncated":     bt.UnmarshalBinary(raw[:len(raw)-1]),
+		"trailing":      bt.UnmarshalBinary(append(raw, 0)),
+		"bad version":   bt.UnmarshalBinary(append([]byte{raw[0], 99}, raw[2:]...)),
+		"key as pubkey": func() error { _, err := ppassrc.UnmarshalPublicKey(issuer.MarshalKey()); return err }(),
+	}
+	for name, err := range cases {
+		if !errors.Is(err, ppassrc.ErrMalformed) {
+			t.Errorf("%s: expected ErrMalformed, got %v", name, err)
+		}
+	}
+}
+
+// Request state records the issuer key and Hctx version it was made for and
+// survives an encoding round trip, e.g. through a file across a restart.
+func TestRequestStateBinding(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithHctxVersion(ppassrc.HctxV2))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey(), ppassrc.WithClientHctxVersion(ppassrc.HctxV2))
+	ctx := ppassrc.NewContextRandomEpoch()
+	b, aux, _ := client.Request(ctx)
+	ev, _ := issuer.Issue(b)
+
+	raw, _ := aux.MarshalBinary()
+	var restored ppassrc.RequestAux
+	if err := restored.UnmarshalBinary(raw); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if !bytes.Equal(restored.KeyID, issuer.KeyID()) || restored.Hctx != ppassrc.HctxV2 {
+		t.Fatalf("restored state has key ID %x, Hctx %d", restored.KeyID, restored.Hctx)
+	}
+
+	other, _ := ppassrc.NewIssuer()
+	wrongKey, _ := ppassrc.NewClient(other.VerificationKey(), ppassrc.WithClientHctxVersion(ppassrc.HctxV2))
+	if _, err := wrongKey.Finalize(ev, restored); !errors.Is(err, ppassrc.ErrStateMismatch) {
+		t.Errorf("finalize with another issuer key: err = %v, want ErrStateMismatch", err)
+	}
+	wrongHctx, _ := ppassrc.NewClient(issuer.VerificationKey(), ppassrc.WithClientHctxVersion(ppassrc.HctxV1))
+	if _, err := wrongHctx.Finalize(ev, restored); !errors.Is(err, ppassrc.ErrStateMismatch) {
+		t.Errorf("finalize under another Hctx version: err = %v, want ErrStateMismatch", err)
+	}
+
+	restarted, _ := ppassrc.NewClient(issuer.VerificationKey(), ppassrc.WithClientHctxVersion(ppassrc.HctxV2))
+	tok, err := restarted.Finalize(ev, restored)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if ok, _ := issuer.Redeem(ctx, tok); !ok {
+		t.Fatal("token finalized from restored state failed to redeem")
+	}
+}
+
+// State in the version 1 encoding, which records no key ID or Hctx version,
+// is rejected, and Finalize refuses state without them.
+func TestRequestStateUnbound(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	b, aux, _ := client.Request(ppassrc.NewContextRandomEpoch())
+	ev, _ := issuer.Issue(b)
+
+	raw, _ := aux.MarshalBinary()
+	v1 := []byte{raw[0], 1}
+	for _, f := range [][]byte{aux.Nonce, aux.Context, aux.Blind, aux.Blinded} {
+		v1 = binary.BigEndian.AppendUint32(v1, uint32(len(f)))
+		v1 = append(v1, f...)
+	}
+	var restored ppassrc.RequestAux
+	if err := restored.UnmarshalBinary(v1); !errors.Is(err, ppassrc.ErrMalformed) {
+		t.Errorf("version 1 state: err = %v, want ErrMalformed", err)
+	}
+
+	for name, state := range map[string]ppassrc.RequestAux{
+		"no key ID": {Nonce: aux.Nonce, Context: aux.Context, Blind: aux.Blind, Blinded: aux.Blinded, Hctx: aux.Hctx},
+		"no Hctx":   {Nonce: aux.Nonce, Context: aux.Context, Blind: aux.Blind, Blinded: aux.Blinded, KeyID: aux.KeyID},
+	} {
+		if _, err := client.Finalize(ev, state); !errors.Is(err, ppassrc.ErrStateMismatch) {
+			t.Errorf("%s: err = %v, want ErrStateMismatch", name, err)
+		}
+	}
+}
+
+// State is encoded only when its key ID and Hctx version are both valid.
+func TestRequestStateMixedBinding(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	_, aux, _ := client.Request(ppassrc.NewContextRandomEpoch())
+	keyID := issuer.KeyID()
+
+	tests := []struct {
+		name  string
+		keyID []byte
+		hctx  ppassrc.HctxVersion
+		ok    bool
+	}{
+		{"bound", keyID, ppassrc.HctxV1, true},
+		{"bound, Hctx v2", keyID, ppassrc.HctxV2, true},
+		{"unbound", nil, 0, false},
+		{"key ID without Hctx", keyID, 0, false},
+		{"Hctx without key ID", nil, ppassrc.HctxV2, false},
+		{"short key ID", keyID[:1], ppassrc.HctxV2, false},
+		{"unknown Hctx", keyID, 7, false},
+	}
+	for _, tt := range tests {
+		state := aux
+		state.KeyID, state.Hctx = tt.keyID, tt.hctx
+		raw, err := state.MarshalBinary()
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("%s: MarshalBinary succeeded", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: MarshalBinary: %v", tt.name, err)
+			continue
+		}
+		var restored ppassrc.RequestAux
+		if err := restored.UnmarshalBinary(raw); err != nil {
+			t.Errorf("%s: UnmarshalBinary: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(restored.KeyID, tt.keyID) || restored.Hctx != tt.hctx || !bytes.Equal(restored.Blind, aux.Blind) {
+			t.Errorf("%s: restored key ID %x, Hctx %d", tt.name, restored.KeyID, restored.Hctx)
+		}
+	}
+
+	// The decoder rejects a short key ID written by hand: keep the final
+	// Hctx field and replace the 32-byte key ID field before it.
+	state := aux
+	state.KeyID, state.Hctx = keyID, ppassrc.HctxV2
+	raw, _ := state.MarshalBinary()
+	hctxField := raw[len(raw)-5:]
+	short := append(append(raw[:len(raw)-5-4-32:len(raw)-5-4-32], 0, 0, 0, 1, keyID[0]), hctxField...)
+	var restored ppassrc.RequestAux
+	if err := restored.UnmarshalBinary(short); !errors.Is(err, ppassrc.ErrMalformed) {
+		t.Errorf("short key ID: err = %v, want ErrMalformed", err)
+	}
+}
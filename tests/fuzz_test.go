@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+// The fuzz targets use a fixed issuer key and request state so that the seed
+// corpus under testdata/fuzz can hold genuine messages for them.
+const (
+	fuzzIssuerKey  = "05010000001372697374726574746f3235352d53484135313200000020d921d5f5915c9acf6eafdefa69b9e2f9f3459577d0aa6fbb50cd38ac2a804504000000208076ee4e14a05bdbf6fdc1143bbf637bf69353c85fd6a2290c9e1ac91c23606d"
+	fuzzRequestAux = "040200000020fd76d2ec5cbb0cdeca44dcf96ada597cd34b3f4114599fb683a4bdaf0ddf17780000000466757a7a000000209d5502525e3f9c969812761b2d99782ec922aaf82f26217b45776c3b7c97fa06000000205446ad636ed92675eeb2016699778f6ff175bf5960a3b334cce6ee4e0de68d6700000020b470d3a91a9678396af366640daf2e285889d412ba6c84fc3efaf8701a495ce90000000102"
+)
+
+type fuzzFixture struct {
+	issuer *ppassrc.Issuer
+	client *ppassrc.Client
+	aux    ppassrc.RequestAux
+	eval   *ppassrc.Evaluation
+	token  *ppassrc.Token // the only token the fixture issuer ever accepts
+}
+
+func newFuzzFixture(f *testing.F) *fuzzFixture {
+	f.Helper()
+	key, _ := hex.DecodeString(fuzzIssuerKey)
+	issuer, err := ppassrc.NewIssuerFromKey(key, ppassrc.WithHctxVersion(ppassrc.HctxV2))
+	if err != nil {
+		f.Fatalf("NewIssuerFromKey: %v", err)
+	}
+	client, _ := ppassrc.NewClient(issuer.VerificationKey(), ppassrc.WithClientHctxVersion(ppassrc.HctxV2))
+
+	fx := &fuzzFixture{issuer: issuer, client: client}
+	rawAux, _ := hex.DecodeString(fuzzRequestAux)
+	if err := fx.aux.UnmarshalBinary(rawAux); err != nil {
+		f.Fatalf("RequestAux.UnmarshalBinary: %v", err)
+	}
+	fx.eval, err = issuer.Issue(ppassrc.BlindedToken{Blinded: fx.aux.Blinded})
+	if err != nil {
+		f.Fatalf("Issue: %v", err)
+	}
+	fx.token, err = client.Finalize(fx.eval, fx.aux)
+	if err != nil {
+		f.Fatalf("Finalize: %v", err)
+	}
+	return fx
+}
+
+// checkDecode asserts that a decoding error is ErrMalformed and that a
+// successful decode re-encodes to exactly the input.
+func checkDecode(t *testing.T, data []byte, m interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}) bool {
+	t.Helper()
+	if err := m.UnmarshalBinary(data); err != nil {
+		if !errors.Is(err, ppassrc.ErrMalformed) {
+			t.Fatalf("decode error %v does not wrap ErrMalformed", err)
+		}
+		return false
+	}
+	out, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary after decode: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("decoded message re-encodes differently:\n in  %x\n out %x", data, out)
+	}
+	return true
+}
+
+// Finalize must never panic on untrusted evaluations, and any evaluation it
+// accepts must unblind to the one PRF output the issuer's key defines.
+func FuzzFinalize(f *testing.F) {
+	fx := newFuzzFixture(f)
+	genuine, _ := fx.eval.MarshalBinary()
+	f.Add(genuine)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var eval ppassrc.Evaluation
+		if !checkDecode(t, data, &eval) {
+			return
+		}
+		tok, err := fx.client.Finalize(&eval, fx.aux)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(tok.Value, fx.token.Value) {
+			t.Fatalf("Finalize accepted an evaluation yielding a different token: %x", tok.Value)
+		}
+	})
+}
+
+// Redeem must never panic on attacker-controlled tokens and contexts, and
+// must only accept the single genuine token in its own context. Under HctxV1
+// the "context-byte-moved-to-nonce" seed would be accepted.
+func FuzzRedeem(f *testing.F) {
+	fx := newFuzzFixture(f)
+	genuine, _ := fx.token.MarshalBinary()
+	f.Add([]byte(fx.aux.Context), genuine)
+
+	f.Fuzz(func(t *testing.T, rctx, data []byte) {
+		var tok ppassrc.Token
+		if !checkDecode(t, data, &tok) {
+			return
+		}
+		ok, err := fx.issuer.Redeem(ppassrc.NewContext(rctx), &tok)
+		if err != nil {
+			t.Fatalf("Redeem: %v", err)
+		}
+		if !ok {
+			return
+		}
+		fx.issuer.ResetForBench(&tok)
+		if !bytes.Equal(rctx, fx.aux.Context) || !bytes.Equal(tok.Value, fx.token.Value) || !bytes.Equal(tok.Nonce, fx.token.Nonce) {
+			t.Fatalf("Redeem accepted a forged token: context %x, value %x, nonce %x", rctx, tok.Value, tok.Nonce)
+		}
+	})
+}
+
+// Every decoder, key loader and Inspect must handle arbitrary bytes.
+func FuzzUnmarshal(f *testing.F) {
+	fx := newFuzzFixture(f)
+	rawAux, _ := hex.DecodeString(fuzzRequestAux)
+	rawKey, _ := hex.DecodeString(fuzzIssuerKey)
+	f.Add(rawAux)
+	f.Add(rawKey)
+	f.Add(ppassrc.MarshalPublicKey(fx.issuer.VerificationKey()))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkDecode(t, data, new(ppassrc.BlindedToken))
+		checkDecode(t, data, new(ppassrc.Evaluation))
+		checkDecode(t, data, new(ppassrc.Token))
+		checkDecode(t, data, new(ppassrc.RequestAux))
+
+		if pk, err := ppassrc.UnmarshalPublicKey(data); err == nil {
+			if !bytes.Equal(ppassrc.MarshalPublicKey(pk), data) {
+				t.Fatal("public key re-encodes differently")
+			}
+		}
+		if iss, err := ppassrc.NewIssuerFromKey(data); err == nil {
+			if !bytes.Equal(iss.MarshalKey(), data) {
+				t.Fatal("issuer key re-encodes differently")
+			}
+		}
+		_ = ppassrc.Inspect(data).String()
+	})
+}
+
+// Distinct field sets must never build the same context.
+func FuzzContextBuilder(f *testing.F) {
+	f.Add("https://example.com", uint64(1), "login", "", "https://example.com", uint64(2), "login", "")
+	f.Add("a", uint64(0), "bc", "", "ab", uint64(0), "c", "")
+
+	f.Fuzz(func(t *testing.T, o1 string, e1 uint64, a1, s1, o2 string, e2 uint64, a2, s2 string) {
+		c1 := ppassrc.NewContextBuilder().Origin(o1).Epoch(e1).Action(a1).Scope(s1).Build()
+		c2 := ppassrc.NewContextBuilder().Scope(s2).Action(a2).Epoch(e2).Origin(o2).Build()
+		same := o1 == o2 && e1 == e2 && a1 == a2 && s1 == s2
+		if bytes.Equal(c1, c2) != same {
+			t.Fatalf("contexts equal = %v for field sets equal = %v", !same, same)
+		}
+	})
+}
+
+// HctxV2 must separate (ctx, nonce) pairs that concatenate to the same bytes.
+func FuzzHctx(f *testing.F) {
+	f.Add([]byte("ab"), []byte("c"), []byte("a"), []byte("bc"))
+	f.Add([]byte("ctx"), []byte("nonce"), []byte("ctx"), []byte("nonce"))
+
+	f.Fuzz(func(t *testing.T, ctx1, nonce1, ctx2, nonce2 []byte) {
+		h1 := ppassrc.HctxV2.Hash(ctx1, nonce1)
+		h2 := ppassrc.HctxV2.Hash(ctx2, nonce2)
+		same := bytes.Equal(ctx1, ctx2) && bytes.Equal(nonce1, nonce2)
+		if bytes.Equal(h1, h2) != same {
+			t.Fatalf("Hctx equal = %v for inputs equal = %v", !same, same)
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"ppassrc/ppassrc"
+	"ppassrc/ppassrc/games"
+)
+
+// honestTokens obtains n genuine tokens for rctx from the oracle.
+func honestTokens(oracle *games.IssuanceOracle, rctx ppassrc.Context, n int) ([]games.Forgery, error) {
+	client, err := ppassrc.NewClient(oracle.PublicKey(), ppassrc.WithClientHctxVersion(oracle.HctxVersion()))
+	if err != nil {
+		return nil, err
+	}
+	var out []games.Forgery
+	for i := 0; i < n; i++ {
+		b, aux, err := client.Request(rctx)
+		if err != nil {
+			return nil, err
+		}
+		eval, err := oracle.Issue(b)
+		if err != nil {
+			return nil, err
+		}
+		tok, err := client.Finalize(eval, aux)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, games.Forgery{Context: rctx, Token: tok})
+	}
+	return out, nil
+}
+
+// acceptAllStore is a broken spent store that never remembers a token.
+type acceptAllStore struct{}
+
+func (acceptAllStore) Spend([]byte) (bool, error) { return true, nil }
+
+func TestOMUFGame(t *testing.T) {
+	rctx := ppassrc.NewContext([]byte("omuf"))
+
+	strategies := map[string]games.OMUFAdversaryFunc{
+		"honest": func(o *games.IssuanceOracle) ([]games.Forgery, error) {
+			return honestTokens(o, rctx, 3)
+		},
+		"replay": func(o *games.IssuanceOracle) ([]games.Forgery, error) {
+			f, err := honestTokens(o, rctx, 1)
+			if err != nil {
+				return nil, err
+			}
+			return append(f, f[0]), nil
+		},
+		"other context": func(o *games.IssuanceOracle) ([]games.Forgery, error) {
+			f, err := honestTokens(o, rctx, 1)
+			if err != nil {
+				return nil, err
+			}
+			return append(f, games.Forgery{Context: ppassrc.NewContext([]byte("omuf2")), Token: f[0].Token}), nil
+		},
+		// Under HctxV1 moving a context byte into the nonce yields the same
+		// PRF input; the spent set still refuses the second redemption.
+		"concatenation shift": func(o *games.IssuanceOracle) ([]games.Forgery, error) {
+			f, err := honestTokens(o, rctx, 1)
+			if err != nil {
+				return nil, err
+			}
+			tok := f[0].Token
+			shifted := &ppassrc.Token{Value: tok.Value, Nonce: append([]byte{rctx[len(rctx)-1]}, tok.Nonce...)}
+			return append(f, games.Forgery{Context: rctx[:len(rctx)-1], Token: shifted}), nil
+		},
+		"random": func(o *games.IssuanceOracle) ([]games.Forgery, error) {
+			var out []games.Forgery
+			for i := 0; i < 10; i++ {
+				tok := &ppassrc.Token{Value: make([]byte, 64), Nonce: make([]byte, 32)}
+				rand.Read(tok.Value)
+				rand.Read(tok.Nonce)
+				out = append(out, games.Forgery{Context: rctx, Token: tok})
+			}
+			return out, nil
+		},
+	}
+
+	for _, hctx := range []ppassrc.HctxVersion{ppassrc.HctxV1, ppassrc.HctxV2} {
+		for name, adv := range strategies {
+			res, err := games.OMUFGame{Hctx: hctx}.Play(adv)
+			if err != nil {
+				t.Fatalf("hctx v%d %s: %v", hctx, name, err)
+			}
+			if res.Won {
+				t.Errorf("hctx v%d %s: adversary won OMUF with %d accepted for %d queries", hctx, name, res.Accepted, res.Queries)
+			}
+		}
+	}
+}
+
+// The harness must catch a regression that breaks double-spend prevention.
+func TestOMUFGameDetectsBrokenSpentStore(t *testing.T) {
+	rctx := ppassrc.NewContext([]byte("omuf"))
+	game := games.OMUFGame{IssuerOptions: []ppassrc.IssuerOption{ppassrc.WithSpentStore(acceptAllStore{})}}
+
+	res, err := game.Play(games.OMUFAdversaryFunc(func(o *games.IssuanceOracle) ([]games.Forgery, error) {
+		f, err := honestTokens(o, rctx, 1)
+		if err != nil {
+			return nil, err
+		}
+		return append(f, f[0]), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Won {
+		t.Fatalf("replay against a broken spent store not detected: %+v", res)
+	}
+}
+
+func TestOMUFGameQueryBudget(t *testing.T) {
+	game := games.OMUFGame{MaxQueries: 2}
+	_, err := game.Play(games.OMUFAdversaryFunc(func(o *games.IssuanceOracle) ([]games.Forgery, error) {
+		return honestTokens(o, ppassrc.NewContext([]byte("budget")), 3)
+	}))
+	if !errors.Is(err, games.ErrQueryBudget) {
+		t.Fatalf("err = %v, want ErrQueryBudget", err)
+	}
+}
+
+// honestIssuerAdversary runs a correct issuer and guesses from what it saw:
+// it remembers user 0's blinded element and checks whether the first token
+// "looks like" it by comparing leading bytes, which should be chance.
+type honestIssuerAdversary struct {
+	iss     *ppassrc.Issuer
+	blinded [2][]byte
+}
+
+func (a *honestIssuerAdversary) Setup() ([]byte, ppassrc.Context, error) {
+	iss, err := ppassrc.NewIssuer()
+	if err != nil {
+		return nil, nil, err
+	}
+	a.iss = iss
+	return iss.VerificationKey(), ppassrc.NewContext([]byte("unlink")), nil
+}
+
+func (a *honestIssuerAdversary) Issue(user int, b ppassrc.BlindedToken) (*ppassrc.Evaluation, error) {
+	a.blinded[user] = b.Blinded
+	return a.iss.Issue(b)
+}
+
+func (a *honestIssuerAdversary) Guess(first, second *ppassrc.Token) int {
+	if first == nil {
+		return 0
+	}
+	if first.Value[0]&1 == a.blinded[0][0]&1 {
+		return 0
+	}
+	return 1
+}
+
+// keyTaggingAdversary publishes one key but evaluates user 1 under another,
+// hoping to tell the users' tokens apart by key. Clients verify the DLEQ
+// proof against the published key, so user 1 never obtains a token.
+type keyTaggingAdversary struct {
+	published, tagged *ppassrc.Issuer
+}
+
+func (a *keyTaggingAdversary) Setup() ([]byte, ppassrc.Context, error) {
+	var err error
+	if a.published, err = ppassrc.NewIssuer(); err != nil {
+		return nil, nil, err
+	}
+	if a.tagged, err = ppassrc.NewIssuer(); err != nil {
+		return nil, nil, err
+	}
+	return a.published.VerificationKey(), ppassrc.NewContext([]byte("unlink")), nil
+}
+
+func (a *keyTaggingAdversary) Issue(user int, b ppassrc.BlindedToken) (*ppassrc.Evaluation, error) {
+	if user == 1 {
+		return a.tagged.Issue(b)
+	}
+	return a.published.Issue(b)
+}
+
+func (a *keyTaggingAdversary) Guess(first, second *ppassrc.Token) int {
+	if first == nil {
+		return 1
+	}
+	if ok, _ := a.published.Redeem(ppassrc.NewContext([]byte("unlink")), first); ok {
+		return 0
+	}
+	return 1
+}
+
+func TestUnlinkabilityGame(t *testing.T) {
+	const rounds = 200
+	const maxAdvantage = 0.3 // about four standard deviations of blind guessing
+
+	for name, adv := range map[string]games.UnlinkabilityAdversary{
+		"honest issuer": &honestIssuerAdversary{},
+		"key tagging":   &keyTaggingAdversary{},
+	} {
+		res, err := games.UnlinkabilityGame{Rounds: rounds}.Play(adv)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if adv := res.Advantage(); adv > maxAdvantage {
+			t.Errorf("%s: advantage %.2f over %d rounds (%d wins)", name, adv, res.Rounds, res.Wins)
+		}
+		if name == "key tagging" && res.Failed != rounds {
+			t.Errorf("key tagging: %d of %d rounds produced tokens for a tagged key", rounds-res.Failed, rounds)
+		}
+	}
+}
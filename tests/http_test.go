@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"ppassrc/ppassrc"
+)
+
+func TestHTTPIssuer(t *testing.T) {
+	var outcomes []ppassrc.Outcome
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithEventHook(func(ev ppassrc.Event) {
+		if ev.Op == "redeem" {
+			outcomes = append(outcomes, ev.Outcome)
+		}
+	}))
+	srv := httptest.NewServer(ppassrc.NewHTTPHandler(issuer))
+	defer srv.Close()
+
+	remote := ppassrc.NewHTTPIssuer(srv.URL+"/", srv.Client())
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("http"))
+	ctx := context.Background()
+
+	b, aux, _ := client.Request(rctx)
+	eval, err := remote.IssueContext(ctx, b)
+	if err != nil {
+		t.Fatalf("IssueContext: %v", err)
+	}
+	tok, err := client.Finalize(eval, aux)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+
+	if ok, err := remote.RedeemContext(ctx, ppassrc.NewContext([]byte("other")), tok); ok || err != nil {
+		t.Fatalf("redeem under another context = %v, %v; want false, nil", ok, err)
+	}
+	if ok, err := remote.RedeemContext(ctx, rctx, tok); !ok || err != nil {
+		t.Fatalf("redeem = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := remote.RedeemContext(ctx, rctx, tok); ok || err != nil {
+		t.Fatalf("double spend = %v, %v; want false, nil", ok, err)
+	}
+
+	want := []ppassrc.Outcome{ppassrc.OutcomeInvalid, ppassrc.OutcomeAccepted, ppassrc.OutcomeDoubleSpend}
+	if len(outcomes) != len(want) {
+		t.Fatalf("issuer saw %d redemptions, want %d", len(outcomes), len(want))
+	}
+	for i := range want {
+		if outcomes[i] != want[i] {
+			t.Errorf("redemption %d outcome %s, want %s", i, outcomes[i], want[i])
+		}
+	}
+}
+
+func TestHTTPIssuerRejections(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithAttester(ppassrc.NewTestAttester("captcha", []byte("ok"))))
+	srv := httptest.NewServer(ppassrc.NewHTTPHandler(issuer))
+	defer srv.Close()
+
+	remote := ppassrc.NewHTTPIssuer(srv.URL, srv.Client())
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	b, _, _ := client.Request(ppassrc.NewContext([]byte("http")))
+
+	if _, err := remote.IssueContext(context.Background(), b); !errors.Is(err, ppassrc.ErrIssuanceRejected) {
+		t.Errorf("issuance without evidence: err = %v, want ErrIssuanceRejected", err)
+	}
+	if _, err := remote.IssueContext(context.Background(), ppassrc.BlindedToken{Blinded: make([]byte, 32)}); err == nil {
+		t.Error("identity element was evaluated")
+	}
+
+	resp, err := srv.Client().Post(srv.URL+ppassrc.IssuePath, "application/octet-stream", bytes.NewReader([]byte("junk")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("malformed issuance: status %d, want 400", resp.StatusCode)
+	}
+
+	resp, err = srv.Client().Get(srv.URL + ppassrc.RedeemPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET redeem: status %d, want 405", resp.StatusCode)
+	}
+}
+
+// Attestation evidence travels with an HTTP issue request to the issuer's
+// attester.
+func TestHTTPIssuerEvidence(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithAttester(ppassrc.NewTestAttester("captcha", []byte("ok"))))
+	srv := httptest.NewServer(ppassrc.NewHTTPHandler(issuer))
+	defer srv.Close()
+
+	remote := ppassrc.NewHTTPIssuer(srv.URL, srv.Client())
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("http"))
+	ctx := context.Background()
+
+	b, aux, _ := client.Request(rctx)
+	eval, err := remote.IssueWithEvidenceContext(ctx, b, ppassrc.Evidence{"captcha": []byte("ok")})
+	if err != nil {
+		t.Fatalf("IssueWithEvidenceContext: %v", err)
+	}
+	tok, err := client.Finalize(eval, aux)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if ok, err := issuer.Redeem(rctx, tok); !ok || err != nil {
+		t.Fatalf("Redeem = %v, %v; want true, nil", ok, err)
+	}
+
+	for name, ev := range map[string]ppassrc.Evidence{
+		"none":         nil,
+		"wrong":        {"captcha": []byte("no")},
+		"another type": {"device": []byte("ok")},
+	} {
+		if _, err := remote.IssueWithEvidenceContext(ctx, b, ev); !errors.Is(err, ppassrc.ErrIssuanceRejected) {
+			t.Errorf("%s evidence: err = %v, want ErrIssuanceRejected", name, err)
+		}
+	}
+	if _, err := remote.IssueWithEvidenceContext(ctx, b, ppassrc.Evidence{"a=b": nil}); err == nil {
+		t.Error("evidence type containing = was sent")
+	}
+
+	raw, _ := b.MarshalBinary()
+	for _, hdr := range []string{"captcha", "captcha=not base64!", "=b2s=", "captcha=b2s=, captcha=b2s="} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+ppassrc.IssuePath, bytes.NewReader(raw))
+		req.Header.Set(ppassrc.EvidenceHeader, hdr)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s %q: status %d, want 400", ppassrc.EvidenceHeader, hdr, resp.StatusCode)
+		}
+	}
+}
+
+// A client that gives up cancels the server-side spent-store lookup.
+func TestHTTPRedeemCancellation(t *testing.T) {
+	store := &slowSpentStore{MemorySpentStore: ppassrc.NewMemorySpentStore(), release: make(chan struct{})}
+	defer close(store.release)
+	redeemed := make(chan ppassrc.Outcome, 1)
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithSpentStore(store), ppassrc.WithEventHook(func(ev ppassrc.Event) {
+		if ev.Op == "redeem" {
+			redeemed <- ev.Outcome
+		}
+	}))
+	srv := httptest.NewServer(ppassrc.NewHTTPHandler(issuer))
+	defer srv.Close()
+
+	remote := ppassrc.NewHTTPIssuer(srv.URL, srv.Client())
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("http"))
+	b, aux, _ := client.Request(rctx)
+	eval, _ := remote.IssueContext(context.Background(), b)
+	tok, _ := client.Finalize(eval, aux)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if ok, err := remote.RedeemContext(ctx, rctx, tok); ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RedeemContext = %v, %v; want false, DeadlineExceeded", ok, err)
+	}
+
+	select {
+	case outcome := <-redeemed:
+		if outcome != ppassrc.OutcomeError {
+			t.Fatalf("server-side outcome %s, want %s", outcome, ppassrc.OutcomeError)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server kept waiting on the spent store after the client left")
+	}
+	if store.Len() != 0 {
+		t.Fatal("abandoned redemption spent the token")
+	}
+}
+
+// The handler serves requests concurrently, so the issuer behind it is used
+// from many goroutines at once; run with -race.
+func TestHTTPConcurrentRequests(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	srv := httptest.NewServer(ppassrc.NewHTTPHandler(issuer))
+	defer srv.Close()
+	remote := ppassrc.NewHTTPIssuer(srv.URL, srv.Client())
+	rctx := ppassrc.NewContext([]byte("http"))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, _ := ppassrc.NewClient(issuer.VerificationKey())
+			for i := 0; i < 5; i++ {
+				b, aux, _ := client.Request(rctx)
+				eval, err := remote.IssueContext(context.Background(), b)
+				if err != nil {
+					t.Errorf("IssueContext: %v", err)
+					return
+				}
+				tok, err := client.Finalize(eval, aux)
+				if err != nil {
+					t.Errorf("Finalize: %v", err)
+					return
+				}
+				if ok, err := remote.RedeemContext(context.Background(), rctx, tok); !ok || err != nil {
+					t.Errorf("redeem = %v, %v; want true, nil", ok, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
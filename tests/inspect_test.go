@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+func TestInspectWellFormed(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	ctx := ppassrc.NewContextBuilder().Origin("example.com").Epoch(3).Build()
+
+	b, aux, _ := client.Request(ctx)
+	ev, _ := issuer.Issue(b)
+	tok, _ := client.Finalize(ev, aux)
+
+	rawB, _ := b.MarshalBinary()
+	rawEv, _ := ev.MarshalBinary()
+	rawTok, _ := tok.MarshalBinary()
+	rawAux, _ := aux.MarshalBinary()
+
+	msgs := map[string][]byte{
+		"blinded token": rawB,
+		"evaluation":    rawEv,
+		"token":         rawTok,
+		"request state": rawAux,
+		"issuer key":    issuer.MarshalKey(),
+		"public key":    ppassrc.MarshalPublicKey(issuer.VerificationKey()),
+	}
+	for want, raw := range msgs {
+		in := ppassrc.Inspect(raw)
+		if in.Type != want || !in.Valid() {
+			t.Errorf("%s: got type %q, problems %v", want, in.Type, in.Problems)
+		}
+	}
+
+	report := ppassrc.Inspect(rawAux).String()
+	if !strings.Contains(report, `origin="example.com" epoch=3`) {
+		t.Errorf("structured context not decoded:\n%s", report)
+	}
+	if strings.Contains(report, "blind ") && !strings.Contains(report, "not shown") {
+		t.Errorf("blind leaked in report:\n%s", report)
+	}
+}
+
+func TestInspectExplainsMalformed(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	b, _, _ := client.Request(ppassrc.NewContextRandomEpoch())
+
+	badElement := append([]byte(nil), b.Blinded...)
+	badElement[0] ^= 1
+	rawBad, _ := ppassrc.BlindedToken{Blinded: badElement}.MarshalBinary()
+	rawShort, _ := ppassrc.BlindedToken{Blinded: b.Blinded[:31]}.MarshalBinary()
+	rawTok, _ := ppassrc.Token{Value: make([]byte, 64), Nonce: []byte("short")}.MarshalBinary()
+	rawEv, _ := ppassrc.Evaluation{Eval: []byte{0, 1, 0, 32}}.MarshalBinary()
+
+	cases := []struct {
+		name string
+		raw  []byte
+		want string
+	}{
+		{"invalid element", rawBad, "not a valid ristretto255 element"},
+		{"short element", rawShort, "is 31 bytes"},
+		{"short nonce", rawTok, "nonce is 5 bytes"},
+		{"truncated evaluation", rawEv, "does not deserialize"},
+		{"not a message", []byte("\xffnot a ppassrc message"), "unknown message type"},
+		{"truncated", rawBad[:10], "claims 32 bytes, 4 left"},
+	}
+	for _, tc := range cases {
+		in := ppassrc.Inspect(tc.raw)
+		if in.Valid() {
+			t.Errorf("%s: reported as well-formed", tc.name)
+			continue
+		}
+		if !strings.Contains(strings.Join(in.Problems, "; "), tc.want) {
+			t.Errorf("%s: problems %q do not mention %q", tc.name, in.Problems, tc.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	metrics := ppassrc.NewMetrics()
+	issuer, _ := ppassrc.NewIssuer(
+		ppassrc.WithInstrumentation(metrics),
+		ppassrc.WithAttester(ppassrc.NewTestAttester("captcha", []byte("ok"))),
+	)
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	ctx := ppassrc.NewContextRandomEpoch()
+	evidence := ppassrc.Evidence{"captcha": []byte("ok")}
+
+	b, aux, _ := client.Request(ctx)
+	if _, err := issuer.Issue(b); err == nil {
+		t.Fatal("issuance without evidence succeeded")
+	}
+	ev, _ := issuer.IssueWithEvidence(b, evidence)
+	tok, _ := client.Finalize(ev, aux)
+
+	issuer.Redeem(ctx, tok)
+	issuer.Redeem(ctx, tok)
+	issuer.Redeem(ppassrc.NewContextRandomEpoch(), tok)
+
+	srv := httptest.NewServer(metrics)
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	text := string(body)
+
+	kid := hex.EncodeToString(issuer.KeyID())
+	want := []string{
+		"# TYPE ppassrc_issue_total counter",
+		fmt.Sprintf(`ppassrc_issue_total{key_id="%s",outcome="issued"} 1`, kid),
+		fmt.Sprintf(`ppassrc_issue_total{key_id="%s",outcome="attestation_failed"} 1`, kid),
+		fmt.Sprintf(`ppassrc_redeem_total{key_id="%s",outcome="accepted"} 1`, kid),
+		fmt.Sprintf(`ppassrc_redeem_total{key_id="%s",outcome="double_spend"} 1`, kid),
+		fmt.Sprintf(`ppassrc_redeem_total{key_id="%s",outcome="invalid"} 1`, kid),
+		"# TYPE ppassrc_redeem_duration_seconds histogram",
+		fmt.Sprintf(`ppassrc_redeem_duration_seconds_bucket{key_id="%s",outcome="accepted",le="+Inf"} 1`, kid),
+		fmt.Sprintf(`ppassrc_redeem_duration_seconds_count{key_id="%s",outcome="invalid"} 1`, kid),
+		fmt.Sprintf(`ppassrc_spent_tokens{key_id="%s"} 1`, kid),
+	}
+	for _, line := range want {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("missing %q in exposition:\n%s", line, text)
+		}
+	}
+}
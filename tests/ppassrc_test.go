@@ -23,6 +23,35 @@ func TestUnlinkability(t *testing.T) {
 	}
 }
 
+// Every request of one client is blinded with a fresh scalar; reusing one
+// blind across requests would link them through the blinded elements.
+func TestClientFreshBlinds(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	ctx := ppassrc.NewContextRandomEpoch()
+
+	b1, aux1, _ := client.Request(ctx)
+	b2, aux2, _ := client.Request(ctx)
+	if bytes.Equal(aux1.Blind, aux2.Blind) {
+		t.Fatal("client reused its blind across requests")
+	}
+
+	// Each request finalizes with its own state, even after a later request.
+	for _, r := range []struct {
+		b   ppassrc.BlindedToken
+		aux ppassrc.RequestAux
+	}{{b1, aux1}, {b2, aux2}} {
+		ev, _ := issuer.Issue(r.b)
+		tok, err := client.Finalize(ev, r.aux)
+		if err != nil {
+			t.Fatalf("Finalize: %v", err)
+		}
+		if ok, _ := issuer.Redeem(ctx, tok); !ok {
+			t.Fatal("token finalized out of order rejected")
+		}
+	}
+}
+
 // 2. One-more unforgeability style: double spend rejected
 func TestOMUF(t *testing.T) {
 	issuer, _ := ppassrc.NewIssuer()
@@ -117,3 +146,51 @@ func TestRobustness(t *testing.T) {
 		t.Fatal("robustness violated: honest token rejected after noise")
 	}
 }
+
+func TestTimeWindowGracePeriod(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+
+	window := time.Hour
+	boundary := time.Date(2025, time.November, 17, 10, 0, 0, 0, time.UTC)
+	minted := boundary.Add(-time.Second)
+	redeemed := boundary.Add(2 * time.Second)
+
+	mint := func(at time.Time) *ppassrc.Token {
+		b, aux, _ := client.Request(ppassrc.NewContextTimeWindow(at, window))
+		ev, _ := issuer.Issue(b)
+		tok, _ := client.Finalize(ev, aux)
+		return tok
+	}
+
+	tok := mint(minted)
+	if _, ok, _ := issuer.RedeemTimeWindow(redeemed, window, 0, tok); ok {
+		t.Fatal("token from the previous window redeemed without a grace period")
+	}
+
+	m, ok, err := issuer.RedeemTimeWindow(redeemed, window, 1, tok)
+	if err != nil || !ok {
+		t.Fatalf("token from the previous window rejected within grace: ok=%v err=%v", ok, err)
+	}
+	if m.Offset != -1 || !m.Start.Equal(boundary.Add(-window)) {
+		t.Fatalf("unexpected match: offset %d start %s", m.Offset, m.Start)
+	}
+
+	if _, ok, _ := issuer.RedeemTimeWindow(redeemed, window, 1, tok); ok {
+		t.Fatal("double spend accepted across grace windows")
+	}
+	if ok, _ := issuer.Redeem(ppassrc.NewContextTimeWindow(minted, window), tok); ok {
+		t.Fatal("double spend accepted via exact window redemption")
+	}
+
+	// A client clock running ahead mints for the next window.
+	ahead := mint(redeemed.Add(window))
+	if m, ok, _ := issuer.RedeemTimeWindow(redeemed, window, 1, ahead); !ok || m.Offset != 1 {
+		t.Fatal("token from the next window rejected within grace")
+	}
+
+	stale := mint(minted.Add(-window))
+	if _, ok, _ := issuer.RedeemTimeWindow(redeemed, window, 1, stale); ok {
+		t.Fatal("token two windows old redeemed with a grace of one")
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ppassrc/ppassrc"
+)
+
+func TestQuotaIssuerTokenBucket(t *testing.T) {
+	issuer, err := ppassrc.NewIssuer()
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+	client, err := ppassrc.NewClient(issuer.VerificationKey())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	now := time.Date(2025, time.November, 17, 12, 0, 0, 0, time.UTC)
+	tb := ppassrc.NewTokenBucket(2, time.Minute, 3)
+	tb.Now = func() time.Time { return now }
+
+	q := ppassrc.NewQuotaIssuer(issuer, ppassrc.IdentityFromMetadata("account"), tb)
+	ctx := ppassrc.NewContextRandomEpoch()
+
+	issue := func(account string) error {
+		b, aux, err := client.Request(ctx)
+		if err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		ev, err := q.Issue(ppassrc.IssuanceRequest{
+			Blinded:  b,
+			Metadata: map[string]string{"account": account},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := client.Finalize(ev, aux); err != nil {
+			t.Fatalf("Finalize: %v", err)
+		}
+		return nil
+	}
+
+	// The burst allows three tokens up front.
+	for i := 0; i < 3; i++ {
+		if err := issue("alice"); err != nil {
+			t.Fatalf("issuance %d within burst failed: %v", i, err)
+		}
+	}
+
+	err = issue("alice")
+	var qe *ppassrc.QuotaExceededError
+	if !errors.As(err, &qe) {
+		t.Fatalf("expected QuotaExceededError, got %v", err)
+	}
+	if qe.Identity != "alice" || qe.RetryAfter != 30*time.Second {
+		t.Fatalf("unexpected quota error: %+v", qe)
+	}
+
+	// Quotas are tracked per identity.
+	if err := issue("bob"); err != nil {
+		t.Fatalf("bob should have a separate quota: %v", err)
+	}
+
+	// Two tokens per minute: one refills every 30s.
+	now = now.Add(30 * time.Second)
+	if err := issue("alice"); err != nil {
+		t.Fatalf("issuance after refill failed: %v", err)
+	}
+	if err := issue("alice"); !errors.As(err, &qe) {
+		t.Fatalf("expected quota to be exhausted again, got %v", err)
+	}
+}
+
+func TestTokenBucketInvalid(t *testing.T) {
+	tb := ppassrc.NewTokenBucket(1, time.Hour, 0)
+	if _, _, err := tb.Allow("alice", 1); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	// A negative charge must not refill the bucket.
+	for _, n := range []int{-5, 0} {
+		if ok, _, err := tb.Allow("alice", n); ok || err == nil {
+			t.Errorf("Allow(%d) = %v, %v; want an error", n, ok, err)
+		}
+	}
+	if ok, _, _ := tb.Allow("alice", 1); ok {
+		t.Error("bucket refilled by an invalid charge")
+	}
+
+	for name, tb := range map[string]*ppassrc.TokenBucket{
+		"zero":      {},
+		"no window": {Limit: 1},
+		"no limit":  {Window: time.Minute},
+	} {
+		if ok, _, err := tb.Allow("alice", 1); ok || err == nil {
+			t.Errorf("%s bucket: Allow = %v, %v; want an error", name, ok, err)
+		}
+	}
+}
+
+func TestQuotaIssuerMissingIdentity(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+
+	q := ppassrc.NewQuotaIssuer(issuer, ppassrc.IdentityFromMetadata("account"), ppassrc.NewTokenBucket(10, time.Hour, 0))
+
+	b, _, _ := client.Request(ppassrc.NewContextRandomEpoch())
+	if _, err := q.Issue(ppassrc.IssuanceRequest{Blinded: b}); !errors.Is(err, ppassrc.ErrNoIdentity) {
+		t.Fatalf("expected ErrNoIdentity, got %v", err)
+	}
+}
+
+// Requests that fail attestation must not spend the quota of the identity
+// they name, or anyone could exhaust another account's quota.
+func TestQuotaIssuerChargesAfterAttestation(t *testing.T) {
+	attests := 0
+	captcha := ppassrc.NewTestAttester("captcha", []byte("solved"))
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithAttester(ppassrc.AttesterFunc(func(ev ppassrc.Evidence) error {
+		attests++
+		return captcha.Attest(ev)
+	})))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	q := ppassrc.NewQuotaIssuer(issuer, ppassrc.IdentityFromMetadata("account"), ppassrc.NewTokenBucket(1, time.Hour, 0))
+
+	issue := func(answer string) error {
+		b, _, _ := client.Request(ppassrc.NewContextRandomEpoch())
+		_, err := q.Issue(ppassrc.IssuanceRequest{
+			Blinded:  b,
+			Metadata: map[string]string{"account": "alice"},
+			Evidence: ppassrc.Evidence{"captcha": []byte(answer)},
+		})
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := issue("guess"); !errors.Is(err, ppassrc.ErrAttestationFailed) {
+			t.Fatalf("unattested request %d: err = %v, want ErrAttestationFailed", i, err)
+		}
+	}
+	if err := issue("solved"); err != nil {
+		t.Fatalf("attested request after rejected ones: %v", err)
+	}
+	var qe *ppassrc.QuotaExceededError
+	if err := issue("solved"); !errors.As(err, &qe) {
+		t.Fatalf("second attested request: err = %v, want QuotaExceededError", err)
+	}
+	if attests != 5 {
+		t.Fatalf("attester ran %d times for 5 requests", attests)
+	}
+}
@@ -0,0 +1,278 @@
+package tests
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+func randomKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, 64)
+		_, _ = rand.Read(keys[i])
+	}
+	return keys
+}
+
+func TestCuckooFilter(t *testing.T) {
+	const n = 10000
+	f := ppassrc.NewCuckooFilter(n)
+	keys := randomKeys(n)
+	for i, k := range keys {
+		if err := f.Insert(k); err != nil {
+			t.Fatalf("Insert %d of %d: %v", i, n, err)
+		}
+	}
+	for i, k := range keys {
+		if !f.Contains(k) {
+			t.Fatalf("false negative for key %d", i)
+		}
+	}
+
+	// The documented bound is 1.2e-4 at capacity; allow for sampling noise.
+	fresh := randomKeys(50000)
+	fp := 0
+	for _, k := range fresh {
+		if f.Contains(k) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / float64(len(fresh)); rate > 5e-4 {
+		t.Errorf("false-positive rate %.2g above bound", rate)
+	}
+
+	for _, k := range keys[:n/2] {
+		if !f.Delete(k) {
+			t.Fatal("Delete did not find an inserted key")
+		}
+	}
+	if f.Len() != n-n/2 {
+		t.Errorf("Len = %d after deleting half, want %d", f.Len(), n-n/2)
+	}
+	for i, k := range keys[n/2:] {
+		if !f.Contains(k) {
+			t.Fatalf("false negative for key %d after deletes", n/2+i)
+		}
+	}
+}
+
+// Overfilling fails Insert but never loses keys that were inserted.
+func TestCuckooFilterFull(t *testing.T) {
+	f := ppassrc.NewCuckooFilter(64)
+	var inserted [][]byte
+	for _, k := range randomKeys(10000) {
+		err := f.Insert(k)
+		if errors.Is(err, ppassrc.ErrFilterFull) {
+			inserted = append(inserted, k) // the key itself went in
+			break
+		}
+		if err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		inserted = append(inserted, k)
+	}
+	if len(inserted) == 10000 {
+		t.Fatal("filter for 64 keys never filled")
+	}
+	if err := f.Insert(randomKeys(1)[0]); !errors.Is(err, ppassrc.ErrFilterFull) {
+		t.Errorf("Insert into a full filter: err = %v", err)
+	}
+	for i, k := range inserted {
+		if !f.Contains(k) {
+			t.Fatalf("key %d lost when the filter filled", i)
+		}
+	}
+}
+
+func TestFilteredSpentStore(t *testing.T) {
+	exacts := map[string]func() ppassrc.SpentStore{
+		"memory":    func() ppassrc.SpentStore { return ppassrc.NewMemorySpentStore() },
+		"truncated": func() ppassrc.SpentStore { return ppassrc.NewTruncatedSpentStore() },
+		// Without SpentAdder every key goes through Spend.
+		"spend-only": func() ppassrc.SpentStore { return struct{ ppassrc.SpentStore }{ppassrc.NewMemorySpentStore()} },
+	}
+	for name, exact := range exacts {
+		t.Run(name, func(t *testing.T) {
+			// Capacity far below the number of keys, so the filter saturates.
+			s := ppassrc.NewFilteredSpentStore(exact(), 16)
+			keys := randomKeys(500)
+			for i, k := range keys {
+				if ok, err := s.Spend(k); !ok || err != nil {
+					t.Fatalf("first spend of key %d = %v, %v", i, ok, err)
+				}
+			}
+			for i, k := range keys {
+				if ok, err := s.Spend(k); ok || err != nil {
+					t.Fatalf("second spend of key %d = %v, %v; want false, nil", i, ok, err)
+				}
+			}
+		})
+	}
+}
+
+// A key spent on a false filter hit goes into the filter too, so that
+// deleting it later leaves the fingerprint of the key it collided with.
+func TestFilteredSpentStoreFalsePositiveDelete(t *testing.T) {
+	// One bucket: any key with k1's fingerprint is a filter hit.
+	store := ppassrc.NewFilteredSpentStore(ppassrc.NewMemorySpentStore(), 1)
+	k1 := []byte("k1")
+	if ok, err := store.Spend(k1); !ok || err != nil {
+		t.Fatalf("Spend(k1) = %v, %v; want true, nil", ok, err)
+	}
+	var k2 []byte
+	for i := uint32(0); k2 == nil; i++ {
+		if i == 1<<24 {
+			t.Fatal("no key collides with k1 in the filter")
+		}
+		if k := binary.BigEndian.AppendUint32([]byte("k2-"), i); store.Filter().Contains(k) {
+			k2 = k
+		}
+	}
+
+	if ok, err := store.Spend(k2); !ok || err != nil {
+		t.Fatalf("Spend(k2) = %v, %v; want true, nil", ok, err)
+	}
+	store.Delete(k2)
+	if ok, err := store.Spend(k1); ok || err != nil {
+		t.Fatalf("Spend(k1) after Delete(k2) = %v, %v; want false, nil", ok, err)
+	}
+}
+
+// addOnlySpentStore is an exact store that can record keys but not delete
+// them, such as an append-only log.
+type addOnlySpentStore struct {
+	spent map[string]bool
+}
+
+func (s *addOnlySpentStore) Spend(key []byte) (bool, error) {
+	if s.spent[string(key)] {
+		return false, nil
+	}
+	s.spent[string(key)] = true
+	return true, nil
+}
+
+func (s *addOnlySpentStore) Add(key []byte) error {
+	s.spent[string(key)] = true
+	return nil
+}
+
+// Deleting from a store whose exact store cannot delete leaves the key spent
+// and in the filter.
+func TestFilteredSpentStoreDeleteWithoutExactDelete(t *testing.T) {
+	store := ppassrc.NewFilteredSpentStore(&addOnlySpentStore{spent: make(map[string]bool)}, 16)
+	key := []byte("key")
+	if ok, err := store.Spend(key); !ok || err != nil {
+		t.Fatalf("Spend = %v, %v; want true, nil", ok, err)
+	}
+	store.Delete(key)
+	if !store.Filter().Contains(key) {
+		t.Fatal("filter dropped a key the exact store still holds")
+	}
+	if ok, err := store.Spend(key); ok || err != nil {
+		t.Fatalf("Spend after Delete = %v, %v; want false, nil", ok, err)
+	}
+}
+
+// Rebuild clears saturation once the live keys fit the filter again.
+func TestFilteredSpentStoreRebuild(t *testing.T) {
+	exact := ppassrc.NewMemorySpentStore()
+	store := ppassrc.NewFilteredSpentStore(exact, 16)
+	keys := randomKeys(200)
+	for _, k := range keys {
+		store.Spend(k)
+	}
+	live := keys[:8]
+	for _, k := range keys[8:] {
+		store.Delete(k)
+	}
+
+	if err := store.Rebuild(keys); !errors.Is(err, ppassrc.ErrFilterFull) {
+		t.Fatalf("Rebuild with too many keys: err = %v, want ErrFilterFull", err)
+	}
+	if err := store.Rebuild(live); err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if n := store.Filter().Len(); n != len(live) {
+		t.Fatalf("rebuilt filter holds %d keys, want %d", n, len(live))
+	}
+	for i, k := range live {
+		if ok, err := store.Spend(k); ok || err != nil {
+			t.Fatalf("spend of live key %d = %v, %v; want false, nil", i, ok, err)
+		}
+	}
+	// Unsaturated again, so deletes reach the filter.
+	store.Delete(live[0])
+	if store.Filter().Len() != len(live)-1 {
+		t.Error("Delete after Rebuild left the filter unchanged")
+	}
+	if ok, err := store.Spend(live[0]); !ok || err != nil {
+		t.Errorf("spend of deleted key = %v, %v; want true, nil", ok, err)
+	}
+}
+
+func TestFilteredSpentStoreRedeem(t *testing.T) {
+	store := ppassrc.NewFilteredSpentStore(ppassrc.NewTruncatedSpentStore(), 1000)
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithSpentStore(store))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("filtered"))
+	b, aux, _ := client.Request(rctx)
+	ev, _ := issuer.Issue(b)
+	tok, _ := client.Finalize(ev, aux)
+
+	// Concurrent redemptions of one token: exactly one wins.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := issuer.Redeem(rctx, tok); ok {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Fatalf("token accepted %d times", accepted)
+	}
+
+	// Deleting an expired token's entry makes room again.
+	store.Delete(tok.Value)
+	if store.Filter().Len() != 0 {
+		t.Errorf("filter holds %d keys after delete", store.Filter().Len())
+	}
+	if ok, _ := issuer.Redeem(rctx, tok); !ok {
+		t.Error("deleted token not accepted")
+	}
+}
+
+func TestTruncatedSpentStore(t *testing.T) {
+	s := ppassrc.NewTruncatedSpentStore()
+	keys := randomKeys(1000)
+	for _, k := range keys {
+		if ok, _ := s.Spend(k); !ok {
+			t.Fatal("fresh key rejected")
+		}
+	}
+	for _, k := range keys {
+		if ok, _ := s.Spend(k); ok {
+			t.Fatal("spent key accepted")
+		}
+	}
+	s.Delete(keys[0])
+	if s.Len() != len(keys)-1 {
+		t.Errorf("Len = %d, want %d", s.Len(), len(keys)-1)
+	}
+	if ok, _ := s.Spend(keys[0]); !ok {
+		t.Error("deleted key rejected")
+	}
+}
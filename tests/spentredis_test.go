@@ -0,0 +1,317 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ppassrc/ppassrc"
+)
+
+// fakeRedis is an in-process stand-in for the subset of Redis that
+// RedisSpentStore uses: AUTH, SELECT and SET with NX and PX, with expiry.
+type fakeRedis struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	password string
+	fail     string               // error reply to every SET when set
+	keys     map[string]time.Time // zero time: no expiry
+	commands [][]string
+	conns    int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{ln: ln, keys: make(map[string]time.Time)}
+	go r.serve()
+	t.Cleanup(func() { ln.Close() })
+	return r
+}
+
+func (r *fakeRedis) addr() string { return r.ln.Addr().String() }
+
+func (r *fakeRedis) serve() {
+	for {
+		c, err := r.ln.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.conns++
+		r.mu.Unlock()
+		go r.handle(c)
+	}
+}
+
+func (r *fakeRedis) handle(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	r.mu.Lock()
+	password, fail := r.password, r.fail
+	r.mu.Unlock()
+	authed := password == ""
+	for {
+		args, err := readCommand(br)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.commands = append(r.commands, args)
+		r.mu.Unlock()
+
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			if len(args) == 2 && args[1] == password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "SELECT":
+			reply = "+OK\r\n"
+		case cmd == "SET" && fail != "":
+			reply = "-" + fail + "\r\n"
+		case cmd == "SET":
+			reply = r.set(args[1:])
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		if _, err := io.WriteString(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (r *fakeRedis) set(args []string) string {
+	if len(args) < 2 {
+		return "-ERR wrong number of arguments\r\n"
+	}
+	var nx bool
+	var expiry time.Time
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "PX":
+			if i+1 == len(args) {
+				return "-ERR syntax error\r\n"
+			}
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || ms <= 0 {
+				return "-ERR invalid expire time\r\n"
+			}
+			expiry = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			i++
+		default:
+			return "-ERR syntax error\r\n"
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if exp, ok := r.keys[args[0]]; ok && nx && (exp.IsZero() || time.Now().Before(exp)) {
+		return "$-1\r\n"
+	}
+	r.keys[args[0]] = expiry
+	return "+OK\r\n"
+}
+
+func readCommand(br *bufio.Reader) ([]string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("not an array: %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad array length: %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("bad bulk length: %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// Redemption nodes sharing one Redis accept every token exactly once between
+// them.
+func TestRedisSpentStoreCluster(t *testing.T) {
+	fake := newFakeRedis(t)
+	ttl := ppassrc.SpentTTL(time.Minute, 1)
+
+	minter, _ := ppassrc.NewIssuer()
+	const nodes = 4
+	redeemers := make([]*ppassrc.Issuer, nodes)
+	for i := range redeemers {
+		store := ppassrc.NewRedisSpentStore(fake.addr(), ttl)
+		defer store.Close()
+		redeemers[i], _ = ppassrc.NewIssuerFromKey(minter.MarshalKey(), ppassrc.WithSpentStore(store))
+	}
+
+	client, _ := ppassrc.NewClient(minter.VerificationKey())
+	now := time.Now()
+	rctx := ppassrc.NewContextTimeWindow(now, time.Minute)
+	const tokens = 20
+	for i := 0; i < tokens; i++ {
+		tok := issueToken(t, minter, client, rctx)
+
+		var accepted atomic.Int32
+		var wg sync.WaitGroup
+		for _, r := range redeemers {
+			wg.Add(1)
+			go func(r *ppassrc.Issuer) {
+				defer wg.Done()
+				_, ok, err := r.RedeemTimeWindow(now, time.Minute, 1, tok)
+				if err != nil {
+					t.Errorf("RedeemTimeWindow: %v", err)
+				}
+				if ok {
+					accepted.Add(1)
+				}
+			}(r)
+		}
+		wg.Wait()
+		if n := accepted.Load(); n != 1 {
+			t.Fatalf("token %d accepted by %d nodes, want 1", i, n)
+		}
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.keys) != tokens {
+		t.Fatalf("redis holds %d keys, want %d", len(fake.keys), tokens)
+	}
+	want := strconv.FormatInt((4 * time.Minute).Milliseconds(), 10)
+	for _, cmd := range fake.commands {
+		if len(cmd) != 6 || cmd[0] != "SET" || !strings.HasPrefix(cmd[1], "ppassrc:spent:") || cmd[3] != "NX" || cmd[4] != "PX" || cmd[5] != want {
+			t.Fatalf("command %q, want SET ppassrc:spent:<key> 1 NX PX %s", cmd, want)
+		}
+	}
+	if fake.conns > nodes*4 {
+		t.Errorf("%d connections for %d spends; idle connections are not reused", fake.conns, len(fake.commands))
+	}
+}
+
+func TestRedisSpentStoreExpiry(t *testing.T) {
+	fake := newFakeRedis(t)
+	store := ppassrc.NewRedisSpentStore(fake.addr(), 20*time.Millisecond)
+	defer store.Close()
+
+	key := []byte("token")
+	if ok, err := store.Spend(key); !ok || err != nil {
+		t.Fatalf("first Spend = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := store.Spend(key); ok || err != nil {
+		t.Fatalf("second Spend = %v, %v; want false, nil", ok, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if ok, err := store.Spend(key); !ok || err != nil {
+		t.Fatalf("Spend after the TTL = %v, %v; want true, nil", ok, err)
+	}
+}
+
+func TestRedisSpentStoreOptions(t *testing.T) {
+	fake := newFakeRedis(t)
+	fake.mu.Lock()
+	fake.password = "hunter2"
+	fake.mu.Unlock()
+
+	wrong := ppassrc.NewRedisSpentStore(fake.addr(), 0, ppassrc.WithRedisPassword("guess"))
+	if _, err := wrong.Spend([]byte("k")); !errors.Is(err, ppassrc.ErrRedis) {
+		t.Fatalf("Spend with a wrong password: %v, want ErrRedis", err)
+	}
+
+	store := ppassrc.NewRedisSpentStore(fake.addr(), 0,
+		ppassrc.WithRedisPassword("hunter2"), ppassrc.WithRedisDB(3), ppassrc.WithRedisKeyPrefix("pp:"))
+	defer store.Close()
+	if ok, err := store.Spend([]byte{0xab}); !ok || err != nil {
+		t.Fatalf("Spend = %v, %v; want true, nil", ok, err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	got := fake.commands[len(fake.commands)-3:]
+	want := [][]string{{"AUTH", "hunter2"}, {"SELECT", "3"}, {"SET", "pp:ab", "1", "NX"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("commands %q, want %q", got, want)
+	}
+}
+
+func TestRedisSpentStoreErrors(t *testing.T) {
+	fake := newFakeRedis(t)
+	fake.mu.Lock()
+	fake.fail = "READONLY You can't write against a read only replica."
+	fake.mu.Unlock()
+	store := ppassrc.NewRedisSpentStore(fake.addr(), time.Minute)
+	defer store.Close()
+
+	// An error reply rejects the token.
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithSpentStore(store))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("redis"))
+	tok := issueToken(t, issuer, client, rctx)
+	if ok, err := issuer.Redeem(rctx, tok); ok || !errors.Is(err, ppassrc.ErrRedis) {
+		t.Fatalf("Redeem = %v, %v; want false and ErrRedis", ok, err)
+	}
+
+	// A server that never answers is abandoned when ctx ends.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	silent := ppassrc.NewRedisSpentStore(ln.Addr().String(), time.Minute)
+	defer silent.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := silent.SpendContext(ctx, []byte("k")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SpendContext against a silent server: %v, want DeadlineExceeded", err)
+	}
+
+	// Nothing listening.
+	addr := ln.Addr().String()
+	ln.Close()
+	if _, err := ppassrc.NewRedisSpentStore(addr, time.Minute).Spend([]byte("k")); err == nil {
+		t.Fatal("Spend without a server succeeded")
+	}
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+func issueToken(t *testing.T, issuer *ppassrc.Issuer, client *ppassrc.Client, rctx ppassrc.Context) *ppassrc.Token {
+	t.Helper()
+	b, aux, err := client.Request(rctx)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	eval, err := issuer.Issue(b)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	tok, err := client.Finalize(eval, aux)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	return tok
+}
+
+// Several redemption nodes sharing the issuer key and one spent-store server
+// accept every token exactly once between them, even when all of them try to
+// redeem it at the same time.
+func TestHTTPSpentStoreCluster(t *testing.T) {
+	store := ppassrc.NewMemorySpentStore()
+	srv := httptest.NewServer(ppassrc.NewSpentStoreHandler(store))
+	defer srv.Close()
+
+	minter, _ := ppassrc.NewIssuer()
+	const nodes = 4
+	redeemers := make([]*ppassrc.Issuer, nodes)
+	for i := range redeemers {
+		var err error
+		redeemers[i], err = ppassrc.NewIssuerFromKey(minter.MarshalKey(),
+			ppassrc.WithSpentStore(ppassrc.NewHTTPSpentStore(srv.URL, srv.Client())))
+		if err != nil {
+			t.Fatalf("NewIssuerFromKey: %v", err)
+		}
+	}
+
+	client, _ := ppassrc.NewClient(minter.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("cluster"))
+	const tokens = 20
+	for i := 0; i < tokens; i++ {
+		tok := issueToken(t, minter, client, rctx)
+
+		var accepted atomic.Int32
+		var wg sync.WaitGroup
+		for _, r := range redeemers {
+			wg.Add(1)
+			go func(r *ppassrc.Issuer) {
+				defer wg.Done()
+				ok, err := r.Redeem(rctx, tok)
+				if err != nil {
+					t.Errorf("Redeem: %v", err)
+				}
+				if ok {
+					accepted.Add(1)
+				}
+			}(r)
+		}
+		wg.Wait()
+		if n := accepted.Load(); n != 1 {
+			t.Fatalf("token %d accepted by %d nodes, want 1", i, n)
+		}
+		if ok, _ := redeemers[i%nodes].Redeem(rctx, tok); ok {
+			t.Fatalf("token %d accepted again after the race", i)
+		}
+	}
+	if store.Len() != tokens {
+		t.Fatalf("store holds %d tokens, want %d", store.Len(), tokens)
+	}
+}
+
+type failingSpentStore struct{}
+
+func (failingSpentStore) Spend([]byte) (bool, error) { return false, errors.New("disk on fire") }
+
+func TestHTTPSpentStoreErrors(t *testing.T) {
+	srv := httptest.NewServer(ppassrc.NewSpentStoreHandler(failingSpentStore{}))
+	defer srv.Close()
+	remote := ppassrc.NewHTTPSpentStore(srv.URL, srv.Client())
+
+	if ok, err := remote.Spend([]byte("key")); ok || err == nil {
+		t.Fatalf("Spend on a failing store = %v, %v; want false and an error", ok, err)
+	}
+
+	// A redemption is rejected, not accepted, when the store cannot answer.
+	issuer, _ := ppassrc.NewIssuer(ppassrc.WithSpentStore(remote))
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("errors"))
+	tok := issueToken(t, issuer, client, rctx)
+	if ok, err := issuer.Redeem(rctx, tok); ok || err == nil {
+		t.Fatalf("Redeem = %v, %v; want false and an error", ok, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ppassrc.NewHTTPSpentStore(srv.URL, srv.Client()).SpendContext(ctx, []byte("key")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SpendContext with a cancelled context: %v", err)
+	}
+
+	resp, err := srv.Client().Get(srv.URL + ppassrc.SpendPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET %s = %d, want %d", ppassrc.SpendPath, resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+// With a shared secret, the store only answers clients that present it.
+func TestHTTPSpentStoreSecret(t *testing.T) {
+	srv := httptest.NewServer(ppassrc.NewSpentStoreHandler(ppassrc.NewMemorySpentStore(), ppassrc.WithSpentStoreSecret("s3cret")))
+	defer srv.Close()
+
+	for name, remote := range map[string]*ppassrc.HTTPSpentStore{
+		"no secret":    ppassrc.NewHTTPSpentStore(srv.URL, srv.Client()),
+		"wrong secret": ppassrc.NewHTTPSpentStore(srv.URL, srv.Client(), ppassrc.WithHTTPSpentStoreSecret("guess")),
+	} {
+		if ok, err := remote.Spend([]byte("key")); ok || err == nil {
+			t.Errorf("%s: Spend = %v, %v; want false and an error", name, ok, err)
+		}
+	}
+
+	remote := ppassrc.NewHTTPSpentStore(srv.URL, srv.Client(), ppassrc.WithHTTPSpentStoreSecret("s3cret"))
+	if ok, err := remote.Spend([]byte("key")); !ok || err != nil {
+		t.Fatalf("Spend = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := remote.Spend([]byte("key")); ok || err != nil {
+		t.Fatalf("second Spend = %v, %v; want false, nil", ok, err)
+	}
+}
@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"bytes"
+	"math"
+	"math/bits"
+	"testing"
+
+	"github.com/bytemare/voprf"
+
+	"ppassrc/ppassrc"
+)
+
+// transcript is what one issuance and redemption reveals, plus the client's
+// secret blind for white-box checks.
+type transcript struct {
+	blinded []byte // seen by the issuer at issuance
+	blind   []byte // client secret
+	input   []byte // Hctx(ctx, nonce), computable by the issuer at redemption
+	value   []byte // seen by the issuer at redemption
+}
+
+// collectTranscripts runs n issuances. With one client, every request comes
+// from the same Client and context; otherwise every request uses a fresh
+// client and a random context.
+func collectTranscripts(t *testing.T, issuer *ppassrc.Issuer, n int, oneClient bool) []transcript {
+	t.Helper()
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("statistical-unlinkability"))
+
+	out := make([]transcript, 0, n)
+	for i := 0; i < n; i++ {
+		if !oneClient {
+			client, _ = ppassrc.NewClient(issuer.VerificationKey())
+			rctx = ppassrc.NewContextRandomEpoch()
+		}
+		b, aux, err := client.Request(rctx)
+		if err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		eval, err := issuer.Issue(b)
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		tok, err := client.Finalize(eval, aux)
+		if err != nil {
+			t.Fatalf("Finalize: %v", err)
+		}
+		out = append(out, transcript{
+			blinded: b.Blinded,
+			blind:   aux.Blind,
+			input:   ppassrc.Hctx(rctx, aux.Nonce),
+			value:   tok.Value,
+		})
+	}
+	return out
+}
+
+func hamming(a, b []byte) int {
+	d := 0
+	for i := range a {
+		d += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return d
+}
+
+func meanVar(xs []float64) (mean, variance float64) {
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	for _, x := range xs {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, variance / float64(len(xs)-1)
+}
+
+// consecutiveDistances returns the Hamming distances between the blinded
+// elements of consecutive transcripts.
+func consecutiveDistances(ts []transcript) []float64 {
+	out := make([]float64, 0, len(ts)-1)
+	for i := 1; i < len(ts); i++ {
+		out = append(out, float64(hamming(ts[i-1].blinded, ts[i].blinded)))
+	}
+	return out
+}
+
+// The thresholds below sit five to six standard deviations out, so an
+// implementation with sound blinding fails them with negligible probability
+// while deterministic, reused or trivial blinds fail them outright.
+func TestStatisticalUnlinkability(t *testing.T) {
+	n := 1000
+	if testing.Short() {
+		n = 300
+	}
+	issuer, _ := ppassrc.NewIssuer()
+	same := collectTranscripts(t, issuer, n, true)
+	baseline := collectTranscripts(t, issuer, n, false)
+
+	t.Run("distinct blinds", func(t *testing.T) {
+		one := make([]byte, 32)
+		one[0] = 1 // little-endian scalar encoding
+		blinded := make(map[string]bool, n)
+		blinds := make(map[string]bool, n)
+		for i, tr := range same {
+			if blinded[string(tr.blinded)] || blinds[string(tr.blind)] {
+				t.Fatalf("request %d repeats an earlier blind or blinded element", i)
+			}
+			if bytes.Equal(tr.blind, one) {
+				t.Fatalf("request %d was blinded with the scalar 1", i)
+			}
+			blinded[string(tr.blinded)] = true
+			blinds[string(tr.blind)] = true
+		}
+	})
+
+	t.Run("blinded element hides the input", func(t *testing.T) {
+		// An issuer that sees the redemption can hash the input to the
+		// group itself; the blinded element must not equal that point.
+		cli, err := voprf.Ristretto255Sha512.Client(voprf.VOPRF, issuer.VerificationKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		one := make([]byte, 32)
+		one[0] = 1
+		for i, tr := range same {
+			p, err := cli.BlindBatchWithBlinds([][]byte{one}, [][]byte{tr.input}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(p[0], tr.blinded) {
+				t.Fatalf("request %d sent its unblinded input", i)
+			}
+		}
+	})
+
+	t.Run("byte distribution", func(t *testing.T) {
+		// The first and last bytes of a ristretto255 encoding carry fixed
+		// bits, so only the inner bytes are expected to be uniform.
+		var hist [256]float64
+		total := 0.0
+		for _, tr := range same {
+			for _, c := range tr.blinded[1:31] {
+				hist[c]++
+				total++
+			}
+		}
+		expected := total / 256
+		chi2 := 0.0
+		for _, obs := range hist {
+			chi2 += (obs - expected) * (obs - expected) / expected
+		}
+		const df = 255
+		if limit := df + 6*math.Sqrt(2*df); chi2 > limit {
+			t.Fatalf("chi-square %.1f over %d degrees of freedom exceeds %.1f", chi2, df, limit)
+		}
+	})
+
+	t.Run("bit bias against baseline", func(t *testing.T) {
+		for bit := 0; bit < 256; bit++ {
+			p1 := bitFrequency(same, bit)
+			p2 := bitFrequency(baseline, bit)
+			pooled := (p1 + p2) / 2
+			if pooled == 0 || pooled == 1 {
+				continue // fixed by the encoding in both samples
+			}
+			z := (p1 - p2) / math.Sqrt(pooled*(1-pooled)*2/float64(n))
+			if math.Abs(z) > 5 {
+				t.Errorf("bit %d set in %.3f of one client's requests but %.3f of fresh clients' (z=%.1f)", bit, p1, p2, z)
+			}
+		}
+	})
+
+	t.Run("correlation across one client and context", func(t *testing.T) {
+		m1, v1 := meanVar(consecutiveDistances(same))
+		m2, v2 := meanVar(consecutiveDistances(baseline))
+		se := math.Sqrt(v1/float64(n-1) + v2/float64(n-1))
+		if math.Abs(m1-m2) > 6*se {
+			t.Fatalf("consecutive requests differ in %.2f bits on average, fresh clients in %.2f (se %.2f)", m1, m2, se)
+		}
+	})
+
+	t.Run("issuance and redemption transcripts", func(t *testing.T) {
+		// Compare each blinded element with its own token value and with the
+		// next transcript's: a matched pair must look like any other pair.
+		matched := make([]float64, 0, n)
+		mismatched := make([]float64, 0, n)
+		for i, tr := range same {
+			next := same[(i+1)%n]
+			matched = append(matched, float64(hamming(tr.blinded, tr.value[:32])))
+			mismatched = append(mismatched, float64(hamming(tr.blinded, next.value[:32])))
+		}
+		m1, v1 := meanVar(matched)
+		m2, v2 := meanVar(mismatched)
+		se := math.Sqrt(v1/float64(n) + v2/float64(n))
+		if math.Abs(m1-m2) > 6*se {
+			t.Fatalf("blinded elements are %.2f bits from their own token value but %.2f from others' (se %.2f)", m1, m2, se)
+		}
+	})
+}
+
+func bitFrequency(ts []transcript, bit int) float64 {
+	set := 0
+	for _, tr := range ts {
+		if tr.blinded[bit/8]>>(bit%8)&1 == 1 {
+			set++
+		}
+	}
+	return float64(set) / float64(len(ts))
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ppassrc/ppassrc"
+)
+
+func TestRemoteVerifier(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	srv := httptest.NewServer(ppassrc.NewVerifierHandler(issuer.Verifier))
+	defer srv.Close()
+	var outcomes []ppassrc.Outcome
+	verifier := ppassrc.NewRemoteVerifier(srv.URL, issuer.VerificationKey(),
+		ppassrc.WithVerifierHTTPClient(srv.Client()),
+		ppassrc.WithVerifierEventHook(func(ev ppassrc.Event) { outcomes = append(outcomes, ev.Outcome) }))
+
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("verifier"))
+	tok := issueToken(t, issuer, client, rctx)
+
+	if ok, err := verifier.Redeem(ppassrc.NewContext([]byte("other")), tok); ok || err != nil {
+		t.Fatalf("redeem under another context = %v, %v; want false, nil", ok, err)
+	}
+	if ok, err := verifier.Redeem(rctx, tok); !ok || err != nil {
+		t.Fatalf("redeem = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := verifier.Redeem(rctx, tok); ok || err != nil {
+		t.Fatalf("double spend = %v, %v; want false, nil", ok, err)
+	}
+	want := []ppassrc.Outcome{ppassrc.OutcomeInvalid, ppassrc.OutcomeAccepted, ppassrc.OutcomeDoubleSpend}
+	if len(outcomes) != len(want) {
+		t.Fatalf("verifier hook saw %d redemptions, want %d", len(outcomes), len(want))
+	}
+	for i := range want {
+		if outcomes[i] != want[i] {
+			t.Errorf("redemption %d: outcome %v, want %v", i, outcomes[i], want[i])
+		}
+	}
+
+	// The spent set is the server's.
+	if ok, _ := issuer.Redeem(rctx, tok); ok {
+		t.Fatal("issuer accepted a token its verification service already spent")
+	}
+}
+
+func TestRemoteVerifierServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	issuer, _ := ppassrc.NewIssuer()
+	var outcome ppassrc.Outcome
+	verifier := ppassrc.NewRemoteVerifier(srv.URL, issuer.VerificationKey(),
+		ppassrc.WithVerifierEventHook(func(ev ppassrc.Event) { outcome = ev.Outcome }))
+
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("verifier-down"))
+	tok := issueToken(t, issuer, client, rctx)
+	if ok, err := verifier.Redeem(rctx, tok); ok || err == nil {
+		t.Fatalf("redeem = %v, %v; want false and an error", ok, err)
+	}
+	if outcome != ppassrc.OutcomeError {
+		t.Errorf("outcome = %v, want %v", outcome, ppassrc.OutcomeError)
+	}
+}
+
+func TestVerifierHandler(t *testing.T) {
+	issuer, _ := ppassrc.NewIssuer()
+	srv := httptest.NewServer(ppassrc.NewVerifierHandler(issuer.Verifier))
+	defer srv.Close()
+	remote := ppassrc.NewHTTPIssuer(srv.URL, srv.Client())
+
+	client, _ := ppassrc.NewClient(issuer.VerificationKey())
+	rctx := ppassrc.NewContext([]byte("verifier-http"))
+	b, _, _ := client.Request(rctx)
+	if _, err := remote.IssueContext(context.Background(), b); err == nil {
+		t.Fatal("verifier handler issued a token")
+	}
+
+	tok := issueToken(t, issuer, client, rctx)
+	if ok, err := remote.RedeemContext(context.Background(), rctx, tok); !ok || err != nil {
+		t.Fatalf("redeem = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := remote.RedeemContext(context.Background(), rctx, tok); ok || err != nil {
+		t.Fatalf("double spend = %v, %v; want false, nil", ok, err)
+	}
+}